@@ -0,0 +1,63 @@
+// Package agstracing looks up the tracing details of the span carried by a context.
+//
+// Every lookup reports ok=false when the context carries no valid span context,
+// instead of returning zero IDs that look like real ones in logs.
+package agstracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceparentVersion is the version of the W3C Trace Context traceparent format made by Traceparent.
+const traceparentVersion = "00"
+
+// LookupTracingID returns the hex encoded trace ID of the span in ctx.
+func LookupTracingID(ctx context.Context) (string, bool) {
+	sc, ok := lookupSpanContext(ctx)
+	if !ok {
+		return "", false
+	}
+	return sc.TraceID().String(), true
+}
+
+// LookupSpanID returns the hex encoded span ID of the span in ctx.
+func LookupSpanID(ctx context.Context) (string, bool) {
+	sc, ok := lookupSpanContext(ctx)
+	if !ok {
+		return "", false
+	}
+	return sc.SpanID().String(), true
+}
+
+// IsSampled tells whether the span in ctx is sampled.
+func IsSampled(ctx context.Context) (sampled bool, ok bool) {
+	sc, ok := lookupSpanContext(ctx)
+	if !ok {
+		return false, false
+	}
+	return sc.IsSampled(), true
+}
+
+// Traceparent returns the W3C traceparent header value of the span in ctx,
+// like "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01".
+func Traceparent(ctx context.Context) (string, bool) {
+	sc, ok := lookupSpanContext(ctx)
+	if !ok {
+		return "", false
+	}
+	return FormatTraceparent(sc), true
+}
+
+// FormatTraceparent formats sc as a W3C traceparent header value.
+// Only the sampled flag is kept, as it is the only flag of version 00.
+func FormatTraceparent(sc trace.SpanContext) string {
+	return fmt.Sprintf("%s-%s-%s-%s", traceparentVersion, sc.TraceID(), sc.SpanID(), sc.TraceFlags()&trace.FlagsSampled)
+}
+
+func lookupSpanContext(ctx context.Context) (trace.SpanContext, bool) {
+	sc := trace.SpanContextFromContext(ctx)
+	return sc, sc.IsValid()
+}
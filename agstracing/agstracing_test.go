@@ -0,0 +1,68 @@
+package agstracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/adamluzsi/testcase/assert"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestLookup(t *testing.T) {
+	tID, err := trace.TraceIDFromHex("0af7651916cd43dd8448eb211c80319c")
+	assert.Must(t).Nil(err)
+	sID, err := trace.SpanIDFromHex("b7ad6b7169203331")
+	assert.Must(t).Nil(err)
+
+	t.Run("valid span context", func(t *testing.T) {
+		ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    tID,
+			SpanID:     sID,
+			TraceFlags: trace.FlagsSampled,
+		}))
+
+		traceID, ok := LookupTracingID(ctx)
+		assert.Must(t).True(ok)
+		assert.Must(t).Equal("0af7651916cd43dd8448eb211c80319c", traceID)
+
+		spanID, ok := LookupSpanID(ctx)
+		assert.Must(t).True(ok)
+		assert.Must(t).Equal("b7ad6b7169203331", spanID)
+
+		sampled, ok := IsSampled(ctx)
+		assert.Must(t).True(ok)
+		assert.Must(t).True(sampled)
+
+		traceparent, ok := Traceparent(ctx)
+		assert.Must(t).True(ok)
+		assert.Must(t).Equal("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", traceparent)
+	})
+
+	t.Run("unsampled span context", func(t *testing.T) {
+		ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{TraceID: tID, SpanID: sID}))
+		sampled, ok := IsSampled(ctx)
+		assert.Must(t).True(ok)
+		assert.Must(t).False(sampled)
+		traceparent, _ := Traceparent(ctx)
+		assert.Must(t).Equal("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00", traceparent)
+	})
+
+	t.Run("no span context", func(t *testing.T) {
+		for _, ctx := range []context.Context{
+			context.Background(),
+			trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{TraceID: tID})),
+		} {
+			traceID, ok := LookupTracingID(ctx)
+			assert.Must(t).False(ok)
+			assert.Must(t).Empty(traceID)
+			spanID, ok := LookupSpanID(ctx)
+			assert.Must(t).False(ok)
+			assert.Must(t).Empty(spanID)
+			_, ok = IsSampled(ctx)
+			assert.Must(t).False(ok)
+			traceparent, ok := Traceparent(ctx)
+			assert.Must(t).False(ok)
+			assert.Must(t).Empty(traceparent)
+		}
+	})
+}
@@ -0,0 +1,89 @@
+package agstracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Level is the severity of a diagnostic event or of a log record.
+type Level int
+
+const (
+	// LevelDebug events describe every propagation step, including header values.
+	LevelDebug Level = iota
+	// LevelInfo events describe decisions, like an untrusted trace context being dropped.
+	LevelInfo
+	// LevelWarn events describe problems, like a request without span context.
+	LevelWarn
+	// LevelError events describe failures, like an upstream that cannot be reached.
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	default:
+		return fmt.Sprintf("Level(%d)", int(l))
+	}
+}
+
+// DebugHook receives the diagnostics of the tracing instrumentation,
+// so propagation can be debugged on demand without printing to stdout.
+type DebugHook interface {
+	// Enabled tells whether events of the level are reported, so callers can skip building them.
+	Enabled(level Level) bool
+	// Report receives a diagnostic event.
+	Report(ctx context.Context, level Level, msg string, attrs ...attribute.KeyValue)
+}
+
+// NoopDebugHook discards every event. It is the default DebugHook.
+var NoopDebugHook DebugHook = noopDebugHook{}
+
+type noopDebugHook struct{}
+
+func (noopDebugHook) Enabled(Level) bool { return false }
+
+func (noopDebugHook) Report(context.Context, Level, string, ...attribute.KeyValue) {}
+
+// NewWriterDebugHook reports the events from the min level on, one line each, like:
+//
+//	level=debug msg="header get" key=traceparent
+func NewWriterDebugHook(w io.Writer, min Level) DebugHook {
+	return &writerDebugHook{w: w, min: min}
+}
+
+type writerDebugHook struct {
+	mu  sync.Mutex
+	w   io.Writer
+	min Level
+}
+
+func (h *writerDebugHook) Enabled(level Level) bool { return h.min <= level }
+
+func (h *writerDebugHook) Report(_ context.Context, level Level, msg string, attrs ...attribute.KeyValue) {
+	if !h.Enabled(level) {
+		return
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "level=%s msg=%q", level, msg)
+	for _, attr := range attrs {
+		fmt.Fprintf(&b, " %s=%q", attr.Key, attr.Value.Emit())
+	}
+	b.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, _ = io.WriteString(h.w, b.String())
+}
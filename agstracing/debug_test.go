@@ -0,0 +1,28 @@
+package agstracing
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/adamluzsi/testcase/assert"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestNewWriterDebugHook(t *testing.T) {
+	buf := &bytes.Buffer{}
+	hook := NewWriterDebugHook(buf, LevelInfo)
+	assert.Must(t).False(hook.Enabled(LevelDebug))
+	assert.Must(t).True(hook.Enabled(LevelWarn))
+
+	hook.Report(context.Background(), LevelDebug, "header get", attribute.String("key", "traceparent"))
+	hook.Report(context.Background(), LevelInfo, "untrusted trace context", attribute.String("remote_addr", "203.0.113.1:80"), attribute.Bool("linked", true))
+	assert.Must(t).Equal("level=info msg=\"untrusted trace context\" remote_addr=\"203.0.113.1:80\" linked=\"true\"\n", buf.String())
+}
+
+func TestNoopDebugHook(t *testing.T) {
+	for _, level := range []Level{LevelDebug, LevelInfo, LevelWarn} {
+		assert.Must(t).False(NoopDebugHook.Enabled(level))
+	}
+	NoopDebugHook.Report(context.Background(), LevelWarn, "ignored")
+}
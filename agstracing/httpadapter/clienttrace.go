@@ -0,0 +1,163 @@
+package httpadapter
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// clientTrace turns the net/http/httptrace lifecycle of an outgoing request into telemetry of its client span.
+// The DNS lookup, the connection and the TLS handshake are recorded either as events of the client span,
+// or as child spans of it, while the connection reuse, the request write and the first response byte are always events.
+type clientTrace struct {
+	ctx        context.Context
+	span       trace.Span
+	tracer     trace.Tracer
+	childSpans bool
+
+	mu    sync.Mutex
+	spans map[string]trace.Span
+}
+
+func newClientTrace(ctx context.Context, span trace.Span, tracer trace.Tracer, childSpans bool) *httptrace.ClientTrace {
+	ct := &clientTrace{
+		ctx:        ctx,
+		span:       span,
+		tracer:     tracer,
+		childSpans: childSpans,
+		spans:      make(map[string]trace.Span),
+	}
+	return &httptrace.ClientTrace{
+		DNSStart:             ct.dnsStart,
+		DNSDone:              ct.dnsDone,
+		ConnectStart:         ct.connectStart,
+		ConnectDone:          ct.connectDone,
+		TLSHandshakeStart:    ct.tlsHandshakeStart,
+		TLSHandshakeDone:     ct.tlsHandshakeDone,
+		GotConn:              ct.gotConn,
+		WroteRequest:         ct.wroteRequest,
+		GotFirstResponseByte: ct.gotFirstResponseByte,
+	}
+}
+
+// start begins a lifecycle phase identified by key.
+func (ct *clientTrace) start(key, name string, attrs ...attribute.KeyValue) {
+	if !ct.childSpans {
+		ct.span.AddEvent(name+".start", trace.WithAttributes(attrs...))
+		return
+	}
+	_, span := ct.tracer.Start(ct.ctx, name, trace.WithAttributes(attrs...))
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	ct.spans[key] = span
+}
+
+// end finishes the lifecycle phase identified by key.
+func (ct *clientTrace) end(key, name string, err error, attrs ...attribute.KeyValue) {
+	if err != nil {
+		attrs = append(attrs, attribute.String("error", err.Error()))
+	}
+	if !ct.childSpans {
+		ct.span.AddEvent(name+".done", trace.WithAttributes(attrs...))
+		return
+	}
+	ct.mu.Lock()
+	span, ok := ct.spans[key]
+	delete(ct.spans, key)
+	ct.mu.Unlock()
+	if !ok {
+		return
+	}
+	span.SetAttributes(attrs...)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (ct *clientTrace) dnsStart(info httptrace.DNSStartInfo) {
+	ct.start("dns", "http.dns", attribute.String("net.host.name", info.Host))
+}
+
+func (ct *clientTrace) dnsDone(info httptrace.DNSDoneInfo) {
+	addrs := make([]string, 0, len(info.Addrs))
+	for _, addr := range info.Addrs {
+		addrs = append(addrs, addr.String())
+	}
+	ct.end("dns", "http.dns", info.Err,
+		attribute.String("net.dns.addrs", strings.Join(addrs, ",")),
+		attribute.Bool("net.dns.coalesced", info.Coalesced))
+}
+
+// connectStart may be called several times in parallel, when dialing more than one address.
+func (ct *clientTrace) connectStart(network, addr string) {
+	ct.start("connect:"+network+":"+addr, "http.connect",
+		attribute.String("net.transport", network),
+		attribute.String("net.peer.addr", addr))
+}
+
+func (ct *clientTrace) connectDone(network, addr string, err error) {
+	ct.end("connect:"+network+":"+addr, "http.connect", err,
+		attribute.String("net.transport", network),
+		attribute.String("net.peer.addr", addr))
+}
+
+func (ct *clientTrace) tlsHandshakeStart() {
+	ct.start("tls", "http.tls")
+}
+
+func (ct *clientTrace) tlsHandshakeDone(state tls.ConnectionState, err error) {
+	ct.end("tls", "http.tls", err,
+		attribute.String("tls.version", tlsVersion(state.Version)),
+		attribute.Bool("tls.resumed", state.DidResume),
+		attribute.String("tls.server_name", state.ServerName),
+		attribute.String("tls.negotiated_protocol", state.NegotiatedProtocol))
+}
+
+func (ct *clientTrace) gotConn(info httptrace.GotConnInfo) {
+	attrs := []attribute.KeyValue{
+		attribute.Bool("http.conn.reused", info.Reused),
+		attribute.Bool("http.conn.was_idle", info.WasIdle),
+	}
+	if info.WasIdle {
+		attrs = append(attrs, attribute.String("http.conn.idle_time", info.IdleTime.String()))
+	}
+	if info.Conn != nil {
+		attrs = append(attrs, attribute.String("net.peer.addr", info.Conn.RemoteAddr().String()))
+	}
+	ct.span.AddEvent("http.got_conn", trace.WithAttributes(attrs...))
+}
+
+func (ct *clientTrace) wroteRequest(info httptrace.WroteRequestInfo) {
+	var attrs []attribute.KeyValue
+	if info.Err != nil {
+		attrs = append(attrs, attribute.String("error", info.Err.Error()))
+	}
+	ct.span.AddEvent("http.wrote_request", trace.WithAttributes(attrs...))
+}
+
+func (ct *clientTrace) gotFirstResponseByte() {
+	ct.span.AddEvent("http.first_response_byte")
+}
+
+func tlsVersion(v uint16) string {
+	switch v {
+	case tls.VersionTLS10:
+		return "1.0"
+	case tls.VersionTLS11:
+		return "1.1"
+	case tls.VersionTLS12:
+		return "1.2"
+	case tls.VersionTLS13:
+		return "1.3"
+	default:
+		return ""
+	}
+}
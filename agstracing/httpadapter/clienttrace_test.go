@@ -0,0 +1,73 @@
+package httpadapter
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/adamluzsi/testcase/assert"
+	"go.opentelemetry.io/otel/propagation"
+	traceSDK "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func eventNames(span traceSDK.ReadOnlySpan) []string {
+	var names []string
+	for _, e := range span.Events() {
+		names = append(names, e.Name)
+	}
+	return names
+}
+
+func TestRoundTripper_clientTrace(t *testing.T) {
+	srv := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("Hello, world!"))
+	})
+	// localhost forces a DNS lookup, unlike the IP address of srv.URL
+	url := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+
+	do := func(t *testing.T, childSpans bool) []traceSDK.ReadOnlySpan {
+		tracerProvider, recorder := newRecordingTracerProvider(t)
+		client := &http.Client{Transport: NewRoundTripper(&http.Transport{}, propagation.TraceContext{}, tracerProvider, WithClientTrace(childSpans))}
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
+		assert.Must(t).Nil(err)
+		resp, err := client.Do(req)
+		assert.Must(t).Nil(err)
+		assert.Must(t).Nil(resp.Body.Close())
+		return recorder.Ended()
+	}
+
+	t.Run("lifecycle is recorded as events of the client span", func(t *testing.T) {
+		spans := do(t, false)
+		assert.Must(t).Equal(1, len(spans))
+		names := eventNames(spans[0])
+		for _, expected := range []string{
+			"http.dns.start", "http.dns.done",
+			"http.connect.start", "http.connect.done",
+			"http.got_conn", "http.wrote_request", "http.first_response_byte",
+		} {
+			assert.Must(t).Contain(names, expected)
+		}
+	})
+
+	t.Run("lifecycle phases can be child spans", func(t *testing.T) {
+		spans := do(t, true)
+		var client traceSDK.ReadOnlySpan
+		children := map[string]traceSDK.ReadOnlySpan{}
+		for _, span := range spans {
+			if span.Name() == "HTTP GET" {
+				client = span
+				continue
+			}
+			children[span.Name()] = span
+		}
+		assert.Must(t).NotNil(client)
+		for _, name := range []string{"http.dns", "http.connect"} {
+			child, ok := children[name]
+			assert.Must(t).True(ok, name)
+			assert.Must(t).Equal(client.SpanContext().SpanID(), child.Parent().SpanID())
+		}
+		assert.Must(t).Contain(eventNames(client), "http.got_conn")
+		assert.Must(t).NotContain(eventNames(client), "http.dns.start")
+	})
+}
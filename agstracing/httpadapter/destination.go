@@ -0,0 +1,122 @@
+package httpadapter
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// InjectionAttributeKey is the client span attribute recording how much trace context was sent to the destination.
+const InjectionAttributeKey = attribute.Key("http.trace_context.injection")
+
+// Injection is how much trace context is injected into an outgoing request.
+type Injection int
+
+const (
+	// InjectAll injects everything the propagator carries, like traceparent, tracestate and baggage.
+	InjectAll Injection = iota
+	// InjectTraceParent injects only the W3C traceparent header, without tracestate and baggage.
+	InjectTraceParent
+	// InjectNothing sends no trace context to the destination.
+	InjectNothing
+)
+
+func (i Injection) String() string {
+	switch i {
+	case InjectAll:
+		return "all"
+	case InjectTraceParent:
+		return "traceparent"
+	case InjectNothing:
+		return "nothing"
+	default:
+		return fmt.Sprintf("Injection(%d)", int(i))
+	}
+}
+
+// DestinationPolicy decides how much trace context is injected into a request, based on where it goes.
+type DestinationPolicy func(req *http.Request) Injection
+
+// WithDestinationPolicy sets the policy that keeps internal trace context from leaking to third parties.
+// By default, everything is injected into every request.
+func WithDestinationPolicy(policy DestinationPolicy) Option {
+	return func(c *config) { c.destinationPolicy = policy }
+}
+
+// DestinationRule tells the Injection for the requests it matches.
+type DestinationRule func(req *http.Request) (Injection, bool)
+
+// NewDestinationPolicy makes a DestinationPolicy from rules, where the first matching rule wins.
+// Requests matched by no rule get the fallback Injection.
+func NewDestinationPolicy(fallback Injection, rules ...DestinationRule) DestinationPolicy {
+	return func(req *http.Request) Injection {
+		for _, rule := range rules {
+			if injection, ok := rule(req); ok {
+				return injection
+			}
+		}
+		return fallback
+	}
+}
+
+// MatchHosts matches requests by the host of their URL.
+// A pattern is either a host name like "api.example.com",
+// a wildcard like "*.example.com" that matches the subdomains of example.com,
+// or "*" that matches every host.
+func MatchHosts(injection Injection, patterns ...string) DestinationRule {
+	return func(req *http.Request) (Injection, bool) {
+		host := strings.ToLower(req.URL.Hostname())
+		for _, pattern := range patterns {
+			if matchHost(strings.ToLower(pattern), host) {
+				return injection, true
+			}
+		}
+		return 0, false
+	}
+}
+
+func matchHost(pattern, host string) bool {
+	switch {
+	case pattern == "*":
+		return true
+	case strings.HasPrefix(pattern, "*."):
+		return strings.HasSuffix(host, pattern[1:])
+	default:
+		return pattern == host
+	}
+}
+
+// MatchCIDRs matches requests whose URL host is an IP address within one of the networks, like "10.0.0.0/8".
+// Host names are not resolved, so they never match.
+func MatchCIDRs(injection Injection, cidrs ...string) (DestinationRule, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return func(req *http.Request) (Injection, bool) {
+		ip := net.ParseIP(req.URL.Hostname())
+		if ip == nil {
+			return 0, false
+		}
+		for _, n := range nets {
+			if n.Contains(ip) {
+				return injection, true
+			}
+		}
+		return 0, false
+	}, nil
+}
+
+// MatchFunc matches the requests for which the predicate returns true.
+func MatchFunc(injection Injection, predicate func(req *http.Request) bool) DestinationRule {
+	return func(req *http.Request) (Injection, bool) {
+		return injection, predicate(req)
+	}
+}
@@ -0,0 +1,123 @@
+package httpadapter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adamluzsi/testcase/assert"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestRoundTripper_destinationPolicy(t *testing.T) {
+	propagator := propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+	do := func(t *testing.T, url string, policy DestinationPolicy) (http.Header, string) {
+		var sent http.Header
+		tracerProvider, recorder := newRecordingTracerProvider(t)
+		rt := NewRoundTripper(rtFn(func(req *http.Request) (*http.Response, error) {
+			sent = req.Header
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		}), propagator, tracerProvider, WithDestinationPolicy(policy))
+
+		member, err := baggage.NewMember("user", "123")
+		assert.Must(t).Nil(err)
+		bag, err := baggage.New(member)
+		assert.Must(t).Nil(err)
+		ts, err := trace.ParseTraceState("ags=1")
+		assert.Must(t).Nil(err)
+		ctx := baggage.ContextWithBaggage(context.Background(), bag)
+		ctx = trace.ContextWithRemoteSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    trace.TraceID{0x01},
+			SpanID:     trace.SpanID{0x01},
+			TraceFlags: trace.FlagsSampled,
+			TraceState: ts,
+		}))
+
+		_, err = rt.RoundTrip(httptest.NewRequest(http.MethodGet, url, nil).WithContext(ctx))
+		assert.Must(t).Nil(err)
+		spans := recorder.Ended()
+		assert.Must(t).Equal(1, len(spans))
+		return sent, attributeMap(spans[0].Attributes())[InjectionAttributeKey].AsString()
+	}
+
+	internal, err := MatchCIDRs(InjectAll, "10.0.0.0/8")
+	assert.Must(t).Nil(err)
+	policy := NewDestinationPolicy(InjectNothing,
+		MatchHosts(InjectAll, "*.internal.example.com"),
+		internal,
+		MatchHosts(InjectTraceParent, "partner.example.org"),
+	)
+
+	t.Run("internal hosts get everything", func(t *testing.T) {
+		sent, decision := do(t, "http://users.internal.example.com/", policy)
+		assert.Must(t).NotEmpty(sent.Get(headerKey))
+		assert.Must(t).Equal("user=123", sent.Get("baggage"))
+		assert.Must(t).Equal("ags=1", sent.Get(tracestateHeader))
+		assert.Must(t).Equal("all", decision)
+	})
+
+	t.Run("internal networks get everything", func(t *testing.T) {
+		sent, decision := do(t, "http://10.1.2.3:8080/", policy)
+		assert.Must(t).NotEmpty(sent.Get(headerKey))
+		assert.Must(t).NotEmpty(sent.Get("baggage"))
+		assert.Must(t).Equal("all", decision)
+	})
+
+	t.Run("partners get only traceparent", func(t *testing.T) {
+		sent, decision := do(t, "https://partner.example.org/", policy)
+		assert.Must(t).NotEmpty(sent.Get(headerKey))
+		assert.Must(t).Empty(sent.Get("baggage"))
+		assert.Must(t).Empty(sent.Get(tracestateHeader))
+		assert.Must(t).Equal("traceparent", decision)
+	})
+
+	t.Run("everyone else gets nothing", func(t *testing.T) {
+		sent, decision := do(t, "https://vendor.example.net/", policy)
+		assert.Must(t).Empty(sent.Get(headerKey))
+		assert.Must(t).Empty(sent.Get("baggage"))
+		assert.Must(t).Equal("nothing", decision)
+	})
+
+	t.Run("predicate rules", func(t *testing.T) {
+		sent, decision := do(t, "https://vendor.example.net/", NewDestinationPolicy(InjectNothing,
+			MatchFunc(InjectTraceParent, func(req *http.Request) bool { return req.URL.Scheme == "https" })))
+		assert.Must(t).NotEmpty(sent.Get(headerKey))
+		assert.Must(t).Equal("traceparent", decision)
+	})
+}
+
+func TestMatchHosts(t *testing.T) {
+	rule := MatchHosts(InjectAll, "*.example.com", "API.example.org")
+	for url, expected := range map[string]bool{
+		"http://a.example.com":      true,
+		"http://a.b.example.com:80": true,
+		"http://example.com":        false,
+		"http://notexample.com":     false,
+		"http://api.example.org":    true,
+		"http://www.example.org":    false,
+	} {
+		_, ok := rule(httptest.NewRequest(http.MethodGet, url, nil))
+		assert.Must(t).Equal(expected, ok, url)
+	}
+}
+
+func TestMatchCIDRs(t *testing.T) {
+	_, err := MatchCIDRs(InjectAll, "not-a-cidr")
+	assert.Must(t).NotNil(err)
+
+	rule, err := MatchCIDRs(InjectAll, "192.168.0.0/16", "::1/128")
+	assert.Must(t).Nil(err)
+	for url, expected := range map[string]bool{
+		"http://192.168.1.1":  true,
+		"http://[::1]:8080":   true,
+		"http://172.16.0.1":   false,
+		"http://localhost:80": false,
+	} {
+		_, ok := rule(httptest.NewRequest(http.MethodGet, url, nil))
+		assert.Must(t).Equal(expected, ok, url)
+	}
+}
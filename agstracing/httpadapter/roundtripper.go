@@ -0,0 +1,255 @@
+// Package httpadapter instruments outgoing HTTP requests with OpenTelemetry tracing.
+package httpadapter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"runtime/debug"
+	"sync"
+
+	"github.com/mikejeuga/OTEL_training/agstracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is the import path of this package,
+// used as the instrumentation scope of the tracer that creates the client spans.
+const instrumentationName = "github.com/mikejeuga/OTEL_training/agstracing/httpadapter"
+
+const tracestateHeader = "tracestate"
+
+func instrumentationVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok || info.Main.Version == "" {
+		return "(devel)"
+	}
+	return info.Main.Version
+}
+
+// Option configures the http.RoundTripper made by NewRoundTripper.
+type Option func(*config)
+
+type config struct {
+	spanName             func(req *http.Request) string
+	missingContextPolicy MissingContextPolicy
+	errorHandler         func(req *http.Request, err error)
+	clientTrace          bool
+	clientTraceSpans     bool
+	destinationPolicy    DestinationPolicy
+	debugHook            agstracing.DebugHook
+}
+
+func newConfig(opts []Option) config {
+	c := config{spanName: defaultSpanName, debugHook: agstracing.NoopDebugHook}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// WithSpanNameFormatter sets how the client spans are named.
+// By default, they are named "HTTP METHOD".
+func WithSpanNameFormatter(fn func(req *http.Request) string) Option {
+	return func(c *config) { c.spanName = fn }
+}
+
+// WithClientTrace records the net/http/httptrace lifecycle of the requests on their client span:
+// DNS lookup, connect, TLS handshake, got connection, wrote request and first response byte.
+// When childSpans is true, the DNS lookup, the connect and the TLS handshake are child spans instead of events.
+func WithClientTrace(childSpans bool) Option {
+	return func(c *config) {
+		c.clientTrace = true
+		c.clientTraceSpans = childSpans
+	}
+}
+
+// WithDebugHook sets the hook that receives the diagnostics of the outgoing propagation,
+// like the injected headers. By default, they are discarded.
+func WithDebugHook(hook agstracing.DebugHook) Option {
+	return func(c *config) { c.debugHook = hook }
+}
+
+// ErrMissingSpanContext is reported when an outgoing request has no valid span context,
+// and the MissingContextPolicy is ReportMissingContext.
+var ErrMissingSpanContext = errors.New("httpadapter: outgoing request has no valid span context")
+
+// MissingContextPolicy decides what to do with an outgoing request whose context has no valid span context,
+// like a background call made outside an incoming request.
+type MissingContextPolicy int
+
+const (
+	// StartRootSpan starts a new trace with a root client span, and propagates it. This is the default.
+	StartRootSpan MissingContextPolicy = iota
+	// PropagateNothing sends the request as it is, without a client span and without trace headers.
+	PropagateNothing
+	// ReportMissingContext reports ErrMissingSpanContext to the error handler,
+	// then sends the request as it is, like PropagateNothing.
+	ReportMissingContext
+)
+
+// WithMissingContextPolicy sets what to do with requests that have no valid span context in their context.
+func WithMissingContextPolicy(policy MissingContextPolicy) Option {
+	return func(c *config) { c.missingContextPolicy = policy }
+}
+
+// WithErrorHandler sets the hook that receives the errors of the instrumentation, like ErrMissingSpanContext.
+// By default, they are reported to the global OpenTelemetry error handler with otel.Handle.
+func WithErrorHandler(fn func(req *http.Request, err error)) Option {
+	return func(c *config) { c.errorHandler = fn }
+}
+
+func (c config) handleError(req *http.Request, err error) {
+	if c.errorHandler == nil {
+		otel.Handle(err)
+		return
+	}
+	c.errorHandler(req, err)
+}
+
+func defaultSpanName(req *http.Request) string {
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	return "HTTP " + method
+}
+
+// RoundTripper traces the requests made through its base http.RoundTripper.
+type RoundTripper struct {
+	base       http.RoundTripper
+	propagator propagation.TextMapPropagator
+	tracer     trace.Tracer
+	cfg        config
+}
+
+var _ http.RoundTripper = &RoundTripper{}
+
+// NewRoundTripper wraps base, so every request starts a SpanKindClient span with the HTTP client attributes,
+// and the span context is injected into the outgoing headers with the propagator.
+// When the upstream replies with a W3C traceresponse header, its trace and span IDs are recorded on the span.
+// The span ends when the response body is closed.
+// When base is nil, http.DefaultTransport is used.
+func NewRoundTripper(base http.RoundTripper, propagator propagation.TextMapPropagator, tracerProvider trace.TracerProvider, opts ...Option) *RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &RoundTripper{
+		base:       base,
+		propagator: propagator,
+		tracer:     tracerProvider.Tracer(instrumentationName, trace.WithInstrumentationVersion(instrumentationVersion())),
+		cfg:        newConfig(opts),
+	}
+}
+
+func (rt *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !trace.SpanContextFromContext(req.Context()).IsValid() {
+		rt.cfg.debugHook.Report(req.Context(), agstracing.LevelWarn, "outgoing request without span context",
+			attribute.String("url", req.URL.Redacted()))
+		switch rt.cfg.missingContextPolicy {
+		case PropagateNothing:
+			return rt.base.RoundTrip(req)
+		case ReportMissingContext:
+			rt.cfg.handleError(req, ErrMissingSpanContext)
+			return rt.base.RoundTrip(req)
+		}
+	}
+
+	ctx, span := rt.tracer.Start(req.Context(), rt.cfg.spanName(req),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.HTTPClientAttributesFromHTTPRequest(req)...),
+	)
+
+	if rt.cfg.clientTrace {
+		ctx = httptrace.WithClientTrace(ctx, newClientTrace(ctx, span, rt.tracer, rt.cfg.clientTraceSpans))
+	}
+
+	// a RoundTripper must not modify the request, so the trace headers go on a clone.
+	req = req.Clone(ctx)
+	rt.inject(ctx, span, req)
+
+	resp, err := rt.base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.End()
+		return resp, err
+	}
+
+	span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(resp.StatusCode)...)
+	span.SetAttributes(traceResponseAttributes(resp)...)
+	span.SetStatus(semconv.SpanStatusFromHTTPStatusCodeAndSpanKind(resp.StatusCode, trace.SpanKindClient))
+	resp.Body = newBody(resp.Body, span)
+	return resp, nil
+}
+
+// inject puts the trace context into the outgoing request, as much as the destination policy allows.
+func (rt *RoundTripper) inject(ctx context.Context, span trace.Span, req *http.Request) {
+	injection := InjectAll
+	if rt.cfg.destinationPolicy != nil {
+		injection = rt.cfg.destinationPolicy(req)
+	}
+	span.SetAttributes(InjectionAttributeKey.String(injection.String()))
+	switch injection {
+	case InjectAll:
+		rt.propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	case InjectTraceParent:
+		propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
+		req.Header.Del(tracestateHeader)
+	}
+	if rt.cfg.debugHook.Enabled(agstracing.LevelDebug) {
+		attrs := []attribute.KeyValue{InjectionAttributeKey.String(injection.String()), attribute.String("url", req.URL.Redacted())}
+		for _, field := range rt.propagator.Fields() {
+			if v := req.Header.Get(field); v != "" {
+				attrs = append(attrs, attribute.String(field, v))
+			}
+		}
+		rt.cfg.debugHook.Report(ctx, agstracing.LevelDebug, "injected trace context", attrs...)
+	}
+}
+
+// body ends the client span when the response body is closed.
+type body struct {
+	io.ReadCloser
+	span trace.Span
+	once sync.Once
+}
+
+// writerBody keeps the body writable for protocol upgrades, as net/http returns an io.ReadWriteCloser then.
+type writerBody struct {
+	*body
+	io.Writer
+}
+
+func newBody(rc io.ReadCloser, span trace.Span) io.ReadCloser {
+	if rc == nil || rc == http.NoBody {
+		span.End()
+		return rc
+	}
+	b := &body{ReadCloser: rc, span: span}
+	if w, ok := rc.(io.Writer); ok {
+		return writerBody{body: b, Writer: w}
+	}
+	return b
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		b.span.RecordError(err)
+		b.span.SetStatus(codes.Error, err.Error())
+	}
+	return n, err
+}
+
+func (b *body) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.span.End() })
+	return err
+}
@@ -0,0 +1,281 @@
+package httpadapter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adamluzsi/testcase/assert"
+	"github.com/mikejeuga/OTEL_training/agstracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	traceSDK "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const headerKey = "traceparent"
+
+type rtFn func(req *http.Request) (*http.Response, error)
+
+func (fn rtFn) RoundTrip(req *http.Request) (*http.Response, error) { return fn(req) }
+
+func newRecordingTracerProvider(tb testing.TB) (*traceSDK.TracerProvider, *tracetest.SpanRecorder) {
+	tb.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	return traceSDK.NewTracerProvider(traceSDK.WithSpanProcessor(recorder)), recorder
+}
+
+func newServer(tb testing.TB, h http.HandlerFunc) *httptest.Server {
+	srv := httptest.NewServer(h)
+	tb.Cleanup(srv.Close)
+	return srv
+}
+
+func attributeMap(kvs []attribute.KeyValue) map[attribute.Key]attribute.Value {
+	m := make(map[attribute.Key]attribute.Value, len(kvs))
+	for _, kv := range kvs {
+		m[kv.Key] = kv.Value
+	}
+	return m
+}
+
+func TestRoundTripper(t *testing.T) {
+	t.Run("client span is the child of the context span and is injected into the request", func(t *testing.T) {
+		var received string
+		srv := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+			received = r.Header.Get(headerKey)
+			w.WriteHeader(http.StatusTeapot)
+			_, _ = w.Write([]byte("I'm a teapot"))
+		})
+		tracerProvider, recorder := newRecordingTracerProvider(t)
+		ctx, parent := tracerProvider.Tracer("test").Start(context.Background(), "parent")
+		client := &http.Client{Transport: NewRoundTripper(nil, propagation.TraceContext{}, tracerProvider)}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/path", nil)
+		assert.Must(t).Nil(err)
+		assert.Must(t).Empty(req.Header.Get(headerKey))
+		resp, err := client.Do(req)
+		assert.Must(t).Nil(err)
+		assert.Must(t).Empty(req.Header.Get(headerKey), "the original request must not be modified")
+		assert.Must(t).Equal(0, len(recorder.Ended()), "the span ends when the body is closed")
+		assert.Must(t).Nil(resp.Body.Close())
+		parent.End()
+
+		spans := recorder.Ended()
+		assert.Must(t).Equal(2, len(spans))
+		span := spans[0]
+		assert.Must(t).Equal("HTTP GET", span.Name())
+		assert.Must(t).Equal(trace.SpanKindClient, span.SpanKind())
+		assert.Must(t).Equal(parent.SpanContext().SpanID(), span.Parent().SpanID())
+		assert.Must(t).Contain(received, span.SpanContext().TraceID().String())
+		assert.Must(t).Contain(received, span.SpanContext().SpanID().String())
+
+		attrs := attributeMap(span.Attributes())
+		assert.Must(t).Equal(http.MethodGet, attrs[semconv.HTTPMethodKey].AsString())
+		assert.Must(t).Equal(srv.URL+"/path", attrs[semconv.HTTPURLKey].AsString())
+		assert.Must(t).Equal(int64(http.StatusTeapot), attrs[semconv.HTTPStatusCodeKey].AsInt64())
+		assert.Must(t).Equal(codes.Error, span.Status().Code)
+	})
+
+	t.Run("transport error is recorded on the span", func(t *testing.T) {
+		tracerProvider, recorder := newRecordingTracerProvider(t)
+		expectedErr := errors.New("boom")
+		rt := NewRoundTripper(rtFn(func(req *http.Request) (*http.Response, error) {
+			return nil, expectedErr
+		}), propagation.TraceContext{}, tracerProvider)
+
+		_, err := rt.RoundTrip(httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Must(t).ErrorIs(expectedErr, err)
+
+		spans := recorder.Ended()
+		assert.Must(t).Equal(1, len(spans))
+		assert.Must(t).Equal(codes.Error, spans[0].Status().Code)
+		assert.Must(t).Equal("boom", spans[0].Status().Description)
+		assert.Must(t).Equal(1, len(spans[0].Events()))
+	})
+
+	t.Run("span name can be formatted", func(t *testing.T) {
+		tracerProvider, recorder := newRecordingTracerProvider(t)
+		rt := NewRoundTripper(rtFn(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		}), propagation.TraceContext{}, tracerProvider, WithSpanNameFormatter(func(req *http.Request) string {
+			return "upstream " + req.URL.Path
+		}))
+
+		_, err := rt.RoundTrip(httptest.NewRequest(http.MethodGet, "/users", nil))
+		assert.Must(t).Nil(err)
+		assert.Must(t).Equal(1, len(recorder.Ended()))
+		assert.Must(t).Equal("upstream /users", recorder.Ended()[0].Name())
+	})
+
+	t.Run("writable upgrade bodies stay writable", func(t *testing.T) {
+		tracerProvider, _ := newRecordingTracerProvider(t)
+		rt := NewRoundTripper(rtFn(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusSwitchingProtocols, Body: rwc{}}, nil
+		}), propagation.TraceContext{}, tracerProvider)
+
+		resp, err := rt.RoundTrip(httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Must(t).Nil(err)
+		_, ok := resp.Body.(io.Writer)
+		assert.Must(t).True(ok)
+	})
+}
+
+func TestRoundTripper_missingContextPolicy(t *testing.T) {
+	get := func(t *testing.T, opts ...Option) (string, []traceSDK.ReadOnlySpan) {
+		var received string
+		srv := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+			received = r.Header.Get(headerKey)
+		})
+		tracerProvider, recorder := newRecordingTracerProvider(t)
+		client := &http.Client{Transport: NewRoundTripper(nil, propagation.TraceContext{}, tracerProvider, opts...)}
+		resp, err := client.Get(srv.URL) // context.Background() has no span context
+		assert.Must(t).Nil(err)
+		assert.Must(t).Nil(resp.Body.Close())
+		return received, recorder.Ended()
+	}
+
+	t.Run("by default a new root client span is started and propagated", func(t *testing.T) {
+		received, spans := get(t)
+		assert.Must(t).Equal(1, len(spans))
+		assert.Must(t).False(spans[0].Parent().IsValid())
+		assert.Must(t).Contain(received, spans[0].SpanContext().TraceID().String())
+	})
+
+	t.Run("StartRootSpan", func(t *testing.T) {
+		received, spans := get(t, WithMissingContextPolicy(StartRootSpan))
+		assert.Must(t).Equal(1, len(spans))
+		assert.Must(t).NotEmpty(received)
+	})
+
+	t.Run("PropagateNothing", func(t *testing.T) {
+		received, spans := get(t, WithMissingContextPolicy(PropagateNothing))
+		assert.Must(t).Equal(0, len(spans))
+		assert.Must(t).Empty(received)
+	})
+
+	t.Run("ReportMissingContext", func(t *testing.T) {
+		var reported error
+		received, spans := get(t, WithMissingContextPolicy(ReportMissingContext), WithErrorHandler(func(req *http.Request, err error) {
+			reported = err
+		}))
+		assert.Must(t).ErrorIs(ErrMissingSpanContext, reported)
+		assert.Must(t).Equal(0, len(spans))
+		assert.Must(t).Empty(received)
+	})
+
+	t.Run("policy does not apply when the span context is present", func(t *testing.T) {
+		var reported error
+		srv := newServer(t, func(w http.ResponseWriter, r *http.Request) {})
+		tracerProvider, recorder := newRecordingTracerProvider(t)
+		client := &http.Client{Transport: NewRoundTripper(nil, propagation.TraceContext{}, tracerProvider,
+			WithMissingContextPolicy(ReportMissingContext),
+			WithErrorHandler(func(req *http.Request, err error) { reported = err }))}
+		ctx, span := tracerProvider.Tracer("test").Start(context.Background(), "parent")
+		defer span.End()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+		assert.Must(t).Nil(err)
+		resp, err := client.Do(req)
+		assert.Must(t).Nil(err)
+		assert.Must(t).Nil(resp.Body.Close())
+		assert.Must(t).Nil(reported)
+		assert.Must(t).Equal(1, len(recorder.Ended()))
+	})
+}
+
+type rwc struct{}
+
+func (rwc) Read(p []byte) (int, error)  { return 0, io.EOF }
+func (rwc) Write(p []byte) (int, error) { return len(p), nil }
+func (rwc) Close() error                { return nil }
+
+func TestRoundTripper_traceresponse(t *testing.T) {
+	do := func(t *testing.T, traceresponse string) map[attribute.Key]attribute.Value {
+		tracerProvider, recorder := newRecordingTracerProvider(t)
+		rt := NewRoundTripper(rtFn(func(req *http.Request) (*http.Response, error) {
+			header := http.Header{}
+			if traceresponse != "" {
+				header.Set(traceresponseHeader, traceresponse)
+			}
+			return &http.Response{StatusCode: http.StatusOK, Header: header, Body: http.NoBody}, nil
+		}), propagation.TraceContext{}, tracerProvider)
+		_, err := rt.RoundTrip(httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+		assert.Must(t).Nil(err)
+		assert.Must(t).Equal(1, len(recorder.Ended()))
+		return attributeMap(recorder.Ended()[0].Attributes())
+	}
+
+	t.Run("upstream trace is recorded", func(t *testing.T) {
+		attrs := do(t, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+		assert.Must(t).Equal("0af7651916cd43dd8448eb211c80319c", attrs[TraceResponseTraceIDKey].AsString())
+		assert.Must(t).Equal("b7ad6b7169203331", attrs[TraceResponseSpanIDKey].AsString())
+		assert.Must(t).True(attrs[TraceResponseSampledKey].AsBool())
+	})
+
+	t.Run("missing or malformed headers are ignored", func(t *testing.T) {
+		for _, v := range []string{
+			"",
+			"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331",
+			"00-00000000000000000000000000000000-b7ad6b7169203331-01",
+			"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01-extra",
+			"ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		} {
+			_, ok := do(t, v)[TraceResponseTraceIDKey]
+			assert.Must(t).False(ok, v)
+		}
+	})
+
+	t.Run("future versions may have extra fields", func(t *testing.T) {
+		attrs := do(t, "01-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00-extra")
+		assert.Must(t).Equal("0af7651916cd43dd8448eb211c80319c", attrs[TraceResponseTraceIDKey].AsString())
+		assert.Must(t).False(attrs[TraceResponseSampledKey].AsBool())
+	})
+}
+
+func TestRoundTripper_debugHook(t *testing.T) {
+	buf := &bytes.Buffer{}
+	tracerProvider, _ := newRecordingTracerProvider(t)
+	rt := NewRoundTripper(rtFn(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	}), propagation.TraceContext{}, tracerProvider, WithDebugHook(agstracing.NewWriterDebugHook(buf, agstracing.LevelDebug)))
+
+	_, err := rt.RoundTrip(httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+	assert.Must(t).Nil(err)
+	assert.Must(t).Contain(buf.String(), `level=warn msg="outgoing request without span context" url="http://example.com/"`)
+	assert.Must(t).Contain(buf.String(), `level=debug msg="injected trace context" http.trace_context.injection="all" url="http://example.com/" traceparent="00-`)
+}
+
+func TestRoundTripper_editedTraceState(t *testing.T) {
+	var sent http.Header
+	tracerProvider, _ := newRecordingTracerProvider(t)
+	rt := NewRoundTripper(rtFn(func(req *http.Request) (*http.Response, error) {
+		sent = req.Header
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	}), propagation.TraceContext{}, tracerProvider)
+
+	ts, err := trace.ParseTraceState("rojo=00f067aa0ba902b7")
+	assert.Must(t).Nil(err)
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x01},
+		SpanID:     trace.SpanID{0x01},
+		TraceFlags: trace.FlagsSampled,
+		TraceState: ts,
+	}))
+	ctx, span := tracerProvider.Tracer("test").Start(ctx, "server")
+	defer span.End()
+	vendor, err := agstracing.NewTraceStateVendor("ags")
+	assert.Must(t).Nil(err)
+	ctx, err = vendor.Upsert(ctx, "1")
+	assert.Must(t).Nil(err)
+
+	_, err = rt.RoundTrip(httptest.NewRequest(http.MethodGet, "http://upstream/", nil).WithContext(ctx))
+	assert.Must(t).Nil(err)
+	assert.Must(t).Equal("ags=1,rojo=00f067aa0ba902b7", sent.Get(tracestateHeader))
+}
@@ -0,0 +1,43 @@
+package httpadapter
+
+import (
+	"net/http"
+
+	"github.com/mikejeuga/OTEL_training/agstracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceresponseHeader is the W3C Trace Context Level 2 response header,
+// where an upstream tells the trace it recorded the request in.
+const traceresponseHeader = "traceresponse"
+
+const (
+	// TraceResponseTraceIDKey is the client span attribute with the trace ID reported by the upstream's traceresponse header.
+	TraceResponseTraceIDKey = attribute.Key("http.traceresponse.trace_id")
+	// TraceResponseSpanIDKey is the client span attribute with the span ID reported by the upstream's traceresponse header.
+	TraceResponseSpanIDKey = attribute.Key("http.traceresponse.span_id")
+	// TraceResponseSampledKey is the client span attribute telling whether the upstream sampled the request.
+	TraceResponseSampledKey = attribute.Key("http.traceresponse.sampled")
+)
+
+// traceResponseAttributes describes the upstream's span from the traceresponse header of resp.
+// A missing or malformed header gives no attributes.
+func traceResponseAttributes(resp *http.Response) []attribute.KeyValue {
+	sc, ok := parseTraceResponse(resp.Header.Get(traceresponseHeader))
+	if !ok {
+		return nil
+	}
+	return []attribute.KeyValue{
+		TraceResponseTraceIDKey.String(sc.TraceID().String()),
+		TraceResponseSpanIDKey.String(sc.SpanID().String()),
+		TraceResponseSampledKey.Bool(sc.IsSampled()),
+	}
+}
+
+// parseTraceResponse parses a "version-traceid-spanid-flags" header value.
+// Future versions may append fields after the flags, so only version 00 has to end there.
+func parseTraceResponse(v string) (trace.SpanContext, bool) {
+	sc, err := agstracing.ParseTraceparent(v, agstracing.ParseModeLenient)
+	return sc, err == nil
+}
@@ -0,0 +1,205 @@
+package agstracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// TraceIDKey is the log field with the trace ID of the span in the context of the record.
+	TraceIDKey = attribute.Key("trace_id")
+	// SpanIDKey is the log field with the span ID of the span in the context of the record.
+	SpanIDKey = attribute.Key("span_id")
+	// TraceFlagsKey is the log field with the hex encoded trace flags of the span in the context of the record.
+	TraceFlagsKey = attribute.Key("trace_flags")
+)
+
+// Record is a log record, as it is given to a Sink.
+type Record struct {
+	Time    time.Time
+	Level   Level
+	Message string
+	// Fields are the fields of the Logger, then the fields of the call.
+	// The trace fields are not part of them, a Sink finds them in the context.
+	Fields []attribute.KeyValue
+}
+
+// Sink writes the records of a Logger.
+type Sink interface {
+	Write(ctx context.Context, rec Record)
+}
+
+// SinkFunc is a function that is a Sink.
+type SinkFunc func(ctx context.Context, rec Record)
+
+func (fn SinkFunc) Write(ctx context.Context, rec Record) { fn(ctx, rec) }
+
+// DiscardSink drops every record.
+var DiscardSink Sink = SinkFunc(func(context.Context, Record) {})
+
+// Logger writes structured log records, correlated with the span in the context of each call.
+type Logger struct {
+	sink   Sink
+	min    Level
+	fields []attribute.KeyValue
+	now    func() time.Time
+}
+
+// LoggerOption configures the Logger made by NewLogger.
+type LoggerOption func(*Logger)
+
+// WithMinLevel drops the records below the level. By default, it is LevelInfo.
+func WithMinLevel(level Level) LoggerOption {
+	return func(l *Logger) { l.min = level }
+}
+
+// NewLogger makes a Logger that writes its records to the sink.
+func NewLogger(sink Sink, opts ...LoggerOption) *Logger {
+	l := &Logger{sink: sink, min: LevelInfo, now: time.Now}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// With returns a Logger that adds the fields to every record.
+func (l *Logger) With(fields ...attribute.KeyValue) *Logger {
+	c := *l
+	c.fields = append(append(make([]attribute.KeyValue, 0, len(l.fields)+len(fields)), l.fields...), fields...)
+	return &c
+}
+
+// Enabled tells whether the records of the level are written.
+func (l *Logger) Enabled(level Level) bool { return l.min <= level }
+
+// Debug writes a LevelDebug record.
+func (l *Logger) Debug(ctx context.Context, msg string, fields ...attribute.KeyValue) {
+	l.Log(ctx, LevelDebug, msg, fields...)
+}
+
+// Info writes a LevelInfo record.
+func (l *Logger) Info(ctx context.Context, msg string, fields ...attribute.KeyValue) {
+	l.Log(ctx, LevelInfo, msg, fields...)
+}
+
+// Warn writes a LevelWarn record.
+func (l *Logger) Warn(ctx context.Context, msg string, fields ...attribute.KeyValue) {
+	l.Log(ctx, LevelWarn, msg, fields...)
+}
+
+// Error writes a LevelError record.
+func (l *Logger) Error(ctx context.Context, msg string, fields ...attribute.KeyValue) {
+	l.Log(ctx, LevelError, msg, fields...)
+}
+
+// Log writes a record of the level, when it is enabled.
+func (l *Logger) Log(ctx context.Context, level Level, msg string, fields ...attribute.KeyValue) {
+	if !l.Enabled(level) {
+		return
+	}
+	l.sink.Write(ctx, Record{
+		Time:    l.now(),
+		Level:   level,
+		Message: msg,
+		Fields:  append(append(make([]attribute.KeyValue, 0, len(l.fields)+len(fields)), l.fields...), fields...),
+	})
+}
+
+// TraceFields returns the trace_id, span_id and trace_flags fields of the span in ctx,
+// or nothing when ctx carries no valid span context.
+func TraceFields(ctx context.Context) []attribute.KeyValue {
+	sc, ok := lookupSpanContext(ctx)
+	if !ok {
+		return nil
+	}
+	return []attribute.KeyValue{
+		TraceIDKey.String(sc.TraceID().String()),
+		SpanIDKey.String(sc.SpanID().String()),
+		TraceFlagsKey.String(sc.TraceFlags().String()),
+	}
+}
+
+// Format is the encoding of the records written by NewWriterSink.
+type Format int
+
+const (
+	// FormatLogfmt encodes a record as a line of key=value pairs.
+	FormatLogfmt Format = iota
+	// FormatJSON encodes a record as a JSON object per line.
+	FormatJSON
+)
+
+// NewWriterSink writes the records to w, one line each, with the trace fields of their context.
+func NewWriterSink(w io.Writer, format Format) Sink {
+	return &writerSink{w: w, format: format}
+}
+
+type writerSink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format Format
+}
+
+func (s *writerSink) Write(ctx context.Context, rec Record) {
+	fields := append(TraceFields(ctx), rec.Fields...)
+	var b bytes.Buffer
+	switch s.format {
+	case FormatJSON:
+		encodeJSON(&b, rec, fields)
+	default:
+		encodeLogfmt(&b, rec, fields)
+	}
+	b.WriteByte('\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, _ = s.w.Write(b.Bytes())
+}
+
+func encodeLogfmt(b *bytes.Buffer, rec Record, fields []attribute.KeyValue) {
+	fmt.Fprintf(b, "time=%s level=%s msg=%s", rec.Time.Format(time.RFC3339Nano), rec.Level, logfmtValue(rec.Message))
+	for _, field := range fields {
+		fmt.Fprintf(b, " %s=%s", field.Key, logfmtValue(field.Value.Emit()))
+	}
+}
+
+// logfmtValue quotes the values that would be ambiguous in logfmt.
+func logfmtValue(v string) string {
+	if v == "" || strings.ContainsAny(v, " =\"\t\n\r") {
+		return fmt.Sprintf("%q", v)
+	}
+	return v
+}
+
+func encodeJSON(b *bytes.Buffer, rec Record, fields []attribute.KeyValue) {
+	b.WriteString("{")
+	writeJSONMember(b, "time", rec.Time.Format(time.RFC3339Nano))
+	b.WriteString(",")
+	writeJSONMember(b, "level", rec.Level.String())
+	b.WriteString(",")
+	writeJSONMember(b, "msg", rec.Message)
+	for _, field := range fields {
+		b.WriteString(",")
+		writeJSONMember(b, string(field.Key), field.Value.AsInterface())
+	}
+	b.WriteString("}")
+}
+
+func writeJSONMember(b *bytes.Buffer, key string, value interface{}) {
+	k, _ := json.Marshal(key)
+	v, err := json.Marshal(value)
+	if err != nil {
+		v, _ = json.Marshal(fmt.Sprint(value))
+	}
+	b.Write(k)
+	b.WriteString(":")
+	b.Write(v)
+}
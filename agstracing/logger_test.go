@@ -0,0 +1,75 @@
+package agstracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/adamluzsi/testcase/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestLogger(t *testing.T) {
+	tID, err := trace.TraceIDFromHex("0af7651916cd43dd8448eb211c80319c")
+	assert.Must(t).Nil(err)
+	sID, err := trace.SpanIDFromHex("b7ad6b7169203331")
+	assert.Must(t).Nil(err)
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    tID,
+		SpanID:     sID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+	clock := func(l *Logger) { l.now = func() time.Time { return time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC) } }
+
+	t.Run("logfmt records carry the trace fields", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		logger := NewLogger(NewWriterSink(buf, FormatLogfmt), clock).With(attribute.String("component", "app"))
+		logger.Info(ctx, "calling upstreams", attribute.Int("upstreams", 2), attribute.String("note", "a b"))
+		assert.Must(t).Equal(`time=2022-05-01T12:00:00Z level=info msg="calling upstreams" `+
+			`trace_id=0af7651916cd43dd8448eb211c80319c span_id=b7ad6b7169203331 trace_flags=01 `+
+			`component=app upstreams=2 note="a b"`+"\n", buf.String())
+	})
+
+	t.Run("JSON records carry the trace fields", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		NewLogger(NewWriterSink(buf, FormatJSON), clock).Error(ctx, "upstream call failed", attribute.Bool("retry", false))
+		var rec map[string]interface{}
+		assert.Must(t).Nil(json.Unmarshal(buf.Bytes(), &rec))
+		assert.Must(t).Equal(map[string]interface{}{
+			"time":        "2022-05-01T12:00:00Z",
+			"level":       "error",
+			"msg":         "upstream call failed",
+			"trace_id":    "0af7651916cd43dd8448eb211c80319c",
+			"span_id":     "b7ad6b7169203331",
+			"trace_flags": "01",
+			"retry":       false,
+		}, rec)
+	})
+
+	t.Run("records without span context have no trace fields", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		NewLogger(NewWriterSink(buf, FormatLogfmt), clock).Warn(context.Background(), "no trace")
+		assert.Must(t).Equal(`time=2022-05-01T12:00:00Z level=warn msg="no trace"`+"\n", buf.String())
+	})
+
+	t.Run("records below the min level are dropped", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		logger := NewLogger(NewWriterSink(buf, FormatLogfmt))
+		logger.Debug(ctx, "dropped")
+		assert.Must(t).Empty(buf.String())
+		NewLogger(NewWriterSink(buf, FormatLogfmt), WithMinLevel(LevelDebug)).Debug(ctx, "kept")
+		assert.Must(t).Contain(buf.String(), "msg=kept")
+	})
+
+	t.Run("With does not change the parent logger", func(t *testing.T) {
+		var recs []Record
+		parent := NewLogger(SinkFunc(func(_ context.Context, rec Record) { recs = append(recs, rec) }))
+		_ = parent.With(attribute.String("child", "yes"))
+		parent.Info(ctx, "parent")
+		assert.Must(t).Equal(1, len(recs))
+		assert.Must(t).Equal(0, len(recs[0].Fields))
+	})
+}
@@ -0,0 +1,220 @@
+// Package propagators has the text map propagators of the tracing formats spoken by the services around us,
+// next to the W3C ones of go.opentelemetry.io/otel/propagation.
+package propagators
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	b3ContextHeader      = "b3"
+	b3TraceIDHeader      = "x-b3-traceid"
+	b3SpanIDHeader       = "x-b3-spanid"
+	b3ParentSpanIDHeader = "x-b3-parentspanid"
+	b3SampledHeader      = "x-b3-sampled"
+	b3FlagsHeader        = "x-b3-flags"
+
+	b3DebugFlag = "d"
+)
+
+var (
+	errB3InvalidTraceID  = errors.New("b3: invalid trace ID")
+	errB3InvalidSpanID   = errors.New("b3: invalid span ID")
+	errB3InvalidParentID = errors.New("b3: invalid parent span ID")
+	errB3InvalidSampling = errors.New("b3: invalid sampling state")
+	errB3InvalidFlags    = errors.New("b3: invalid flags")
+	errB3InvalidHeader   = errors.New("b3: invalid single header")
+)
+
+// B3Encoding is the form of the B3 headers injected by the B3 propagator.
+type B3Encoding int
+
+const (
+	// B3MultipleHeader injects X-B3-TraceId, X-B3-SpanId and X-B3-Sampled or X-B3-Flags. This is the default.
+	B3MultipleHeader B3Encoding = iota
+	// B3SingleHeader injects the "b3" header, like "{TraceId}-{SpanId}-{SamplingState}".
+	B3SingleHeader
+)
+
+// B3 propagates the span context in the Zipkin B3 headers.
+// Both the single and the multiple header forms are extracted, the single one first,
+// and 64-bit trace IDs are left-padded with zeros to 128-bit.
+//
+// The debug flag is kept in the context, see ContextWithB3Debug, and implies the sampled flag.
+type B3 struct {
+	// InjectEncoding is the form of the injected headers.
+	InjectEncoding B3Encoding
+}
+
+var _ propagation.TextMapPropagator = B3{}
+
+type b3DebugKey struct{}
+
+// ContextWithB3Debug marks the trace of ctx as forced to be sampled with the B3 debug flag.
+func ContextWithB3Debug(ctx context.Context, debug bool) context.Context {
+	return context.WithValue(ctx, b3DebugKey{}, debug)
+}
+
+// B3DebugFromContext tells whether the trace of ctx has the B3 debug flag.
+func B3DebugFromContext(ctx context.Context) bool {
+	debug, _ := ctx.Value(b3DebugKey{}).(bool)
+	return debug
+}
+
+func (b3 B3) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	debug := B3DebugFromContext(ctx)
+	if b3.InjectEncoding == B3SingleHeader {
+		sampling := "0"
+		switch {
+		case debug:
+			sampling = b3DebugFlag
+		case sc.IsSampled():
+			sampling = "1"
+		}
+		carrier.Set(b3ContextHeader, strings.Join([]string{sc.TraceID().String(), sc.SpanID().String(), sampling}, "-"))
+		return
+	}
+	carrier.Set(b3TraceIDHeader, sc.TraceID().String())
+	carrier.Set(b3SpanIDHeader, sc.SpanID().String())
+	switch {
+	case debug:
+		// the debug flag implies the sampled flag, so X-B3-Sampled is not sent.
+		carrier.Set(b3FlagsHeader, "1")
+	case sc.IsSampled():
+		carrier.Set(b3SampledHeader, "1")
+	default:
+		carrier.Set(b3SampledHeader, "0")
+	}
+}
+
+func (b3 B3) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	var (
+		sc    trace.SpanContext
+		debug bool
+		err   error
+	)
+	if h := carrier.Get(b3ContextHeader); h != "" {
+		sc, debug, err = extractB3Single(h)
+	}
+	if !sc.IsValid() {
+		sc, debug, err = extractB3Multiple(
+			carrier.Get(b3TraceIDHeader),
+			carrier.Get(b3SpanIDHeader),
+			carrier.Get(b3ParentSpanIDHeader),
+			carrier.Get(b3SampledHeader),
+			carrier.Get(b3FlagsHeader),
+		)
+	}
+	if err != nil || !sc.IsValid() {
+		return ctx
+	}
+	if debug {
+		ctx = ContextWithB3Debug(ctx, true)
+	}
+	return trace.ContextWithRemoteSpanContext(ctx, sc)
+}
+
+func (b3 B3) Fields() []string {
+	if b3.InjectEncoding == B3SingleHeader {
+		return []string{b3ContextHeader}
+	}
+	return []string{b3TraceIDHeader, b3SpanIDHeader, b3SampledHeader, b3FlagsHeader}
+}
+
+// extractB3Single parses "{TraceId}-{SpanId}-{SamplingState}-{ParentSpanId}",
+// where the sampling state and the parent span ID are optional.
+// A header with only a sampling state has no span context to extract.
+func extractB3Single(h string) (trace.SpanContext, bool, error) {
+	parts := strings.Split(h, "-")
+	if len(parts) < 2 || len(parts) > 4 {
+		return trace.SpanContext{}, false, errB3InvalidHeader
+	}
+	var sampling, parent string
+	if len(parts) > 2 {
+		sampling = parts[2]
+		if sampling == "" {
+			return trace.SpanContext{}, false, errB3InvalidSampling
+		}
+	}
+	if len(parts) > 3 {
+		parent = parts[3]
+		if parent == "" {
+			return trace.SpanContext{}, false, errB3InvalidParentID
+		}
+	}
+	switch sampling {
+	case "", "0", "1":
+		return extractB3Multiple(parts[0], parts[1], parent, sampling, "")
+	case b3DebugFlag:
+		return extractB3Multiple(parts[0], parts[1], parent, "", "1")
+	default:
+		return trace.SpanContext{}, false, errB3InvalidSampling
+	}
+}
+
+func extractB3Multiple(traceID, spanID, parentSpanID, sampled, flags string) (trace.SpanContext, bool, error) {
+	var (
+		scc   trace.SpanContextConfig
+		err   error
+		debug bool
+	)
+	if len(traceID) != 16 && len(traceID) != 32 || !isLowerHex(traceID) {
+		return trace.SpanContext{}, false, errB3InvalidTraceID
+	}
+	if len(traceID) == 16 {
+		traceID = strings.Repeat("0", 16) + traceID
+	}
+	if scc.TraceID, err = trace.TraceIDFromHex(traceID); err != nil {
+		return trace.SpanContext{}, false, errB3InvalidTraceID
+	}
+	if len(spanID) != 16 || !isLowerHex(spanID) {
+		return trace.SpanContext{}, false, errB3InvalidSpanID
+	}
+	if scc.SpanID, err = trace.SpanIDFromHex(spanID); err != nil {
+		return trace.SpanContext{}, false, errB3InvalidSpanID
+	}
+	if parentSpanID != "" && (len(parentSpanID) != 16 || !isLowerHex(parentSpanID)) {
+		return trace.SpanContext{}, false, errB3InvalidParentID
+	}
+
+	switch flags {
+	case "":
+	case "1":
+		debug = true
+		scc.TraceFlags = trace.FlagsSampled
+	default:
+		return trace.SpanContext{}, false, errB3InvalidFlags
+	}
+	switch strings.ToLower(sampled) {
+	case "":
+	case "1", "true":
+		scc.TraceFlags = trace.FlagsSampled
+	case "0", "false":
+		if debug {
+			return trace.SpanContext{}, false, errB3InvalidSampling
+		}
+	default:
+		return trace.SpanContext{}, false, errB3InvalidSampling
+	}
+	scc.Remote = true
+	return trace.NewSpanContext(scc), debug, nil
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
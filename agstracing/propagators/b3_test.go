@@ -0,0 +1,160 @@
+package propagators
+
+import (
+	"context"
+	"testing"
+
+	"github.com/adamluzsi/testcase/assert"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	traceIDHex   = "4bf92f3577b34da6a3ce929d0e0e4736"
+	traceID64Hex = "a3ce929d0e0e4736"
+	spanIDHex    = "00f067aa0ba902b7"
+	parentIDHex  = "b7ad6b7169203331"
+)
+
+var (
+	traceID, _   = trace.TraceIDFromHex(traceIDHex)
+	traceID64, _ = trace.TraceIDFromHex("0000000000000000" + traceID64Hex)
+	spanID, _    = trace.SpanIDFromHex(spanIDHex)
+)
+
+func TestB3_Extract(t *testing.T) {
+	for name, tc := range map[string]struct {
+		headers map[string]string
+		traceID trace.TraceID
+		sampled bool
+		debug   bool
+		invalid bool
+	}{
+		"single header": {
+			headers: map[string]string{"b3": traceIDHex + "-" + spanIDHex + "-1-" + parentIDHex},
+			traceID: traceID, sampled: true,
+		},
+		"single header without sampling state": {
+			headers: map[string]string{"b3": traceIDHex + "-" + spanIDHex},
+			traceID: traceID,
+		},
+		"single header with 64-bit trace ID": {
+			headers: map[string]string{"b3": traceID64Hex + "-" + spanIDHex + "-0"},
+			traceID: traceID64,
+		},
+		"single header with debug flag": {
+			headers: map[string]string{"b3": traceIDHex + "-" + spanIDHex + "-d"},
+			traceID: traceID, sampled: true, debug: true,
+		},
+		"single header with only a sampling state": {
+			headers: map[string]string{"b3": "1"},
+			invalid: true,
+		},
+		"single header with invalid sampling state": {
+			headers: map[string]string{"b3": traceIDHex + "-" + spanIDHex + "-x"},
+			invalid: true,
+		},
+		"single header with uppercase trace ID": {
+			headers: map[string]string{"b3": "4BF92F3577B34DA6A3CE929D0E0E4736-" + spanIDHex},
+			invalid: true,
+		},
+		"invalid single header falls back to the multiple headers": {
+			headers: map[string]string{"b3": "garbage", "x-b3-traceid": traceIDHex, "x-b3-spanid": spanIDHex, "x-b3-sampled": "1"},
+			traceID: traceID, sampled: true,
+		},
+		"multiple headers": {
+			headers: map[string]string{"x-b3-traceid": traceIDHex, "x-b3-spanid": spanIDHex, "x-b3-parentspanid": parentIDHex, "x-b3-sampled": "1"},
+			traceID: traceID, sampled: true,
+		},
+		"multiple headers with legacy sampled value": {
+			headers: map[string]string{"x-b3-traceid": traceIDHex, "x-b3-spanid": spanIDHex, "x-b3-sampled": "true"},
+			traceID: traceID, sampled: true,
+		},
+		"multiple headers with 64-bit trace ID": {
+			headers: map[string]string{"x-b3-traceid": traceID64Hex, "x-b3-spanid": spanIDHex, "x-b3-sampled": "0"},
+			traceID: traceID64,
+		},
+		"multiple headers with debug flag": {
+			headers: map[string]string{"x-b3-traceid": traceIDHex, "x-b3-spanid": spanIDHex, "x-b3-flags": "1"},
+			traceID: traceID, sampled: true, debug: true,
+		},
+		"debug flag contradicted by the sampled header": {
+			headers: map[string]string{"x-b3-traceid": traceIDHex, "x-b3-spanid": spanIDHex, "x-b3-flags": "1", "x-b3-sampled": "0"},
+			invalid: true,
+		},
+		"multiple headers without span ID": {
+			headers: map[string]string{"x-b3-traceid": traceIDHex},
+			invalid: true,
+		},
+		"multiple headers with invalid parent span ID": {
+			headers: map[string]string{"x-b3-traceid": traceIDHex, "x-b3-spanid": spanIDHex, "x-b3-parentspanid": "short"},
+			invalid: true,
+		},
+		"all-zero trace ID": {
+			headers: map[string]string{"x-b3-traceid": "00000000000000000000000000000000", "x-b3-spanid": spanIDHex},
+			invalid: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := B3{}.Extract(context.Background(), propagation.MapCarrier(tc.headers))
+			sc := trace.SpanContextFromContext(ctx)
+			if tc.invalid {
+				assert.Must(t).False(sc.IsValid())
+				return
+			}
+			assert.Must(t).True(sc.IsValid())
+			assert.Must(t).True(sc.IsRemote())
+			assert.Must(t).Equal(tc.traceID, sc.TraceID())
+			assert.Must(t).Equal(spanID, sc.SpanID())
+			assert.Must(t).Equal(tc.sampled, sc.IsSampled())
+			assert.Must(t).Equal(tc.debug, B3DebugFromContext(ctx))
+		})
+	}
+}
+
+func TestB3_Inject(t *testing.T) {
+	sampled := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+	notSampled := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  spanID,
+	}))
+	debug := ContextWithB3Debug(sampled, true)
+
+	for name, tc := range map[string]struct {
+		ctx      context.Context
+		encoding B3Encoding
+		expected map[string]string
+	}{
+		"single sampled":     {ctx: sampled, encoding: B3SingleHeader, expected: map[string]string{"b3": traceIDHex + "-" + spanIDHex + "-1"}},
+		"single not sampled": {ctx: notSampled, encoding: B3SingleHeader, expected: map[string]string{"b3": traceIDHex + "-" + spanIDHex + "-0"}},
+		"single debug":       {ctx: debug, encoding: B3SingleHeader, expected: map[string]string{"b3": traceIDHex + "-" + spanIDHex + "-d"}},
+		"multiple sampled": {ctx: sampled, encoding: B3MultipleHeader, expected: map[string]string{
+			"x-b3-traceid": traceIDHex, "x-b3-spanid": spanIDHex, "x-b3-sampled": "1",
+		}},
+		"multiple debug": {ctx: debug, encoding: B3MultipleHeader, expected: map[string]string{
+			"x-b3-traceid": traceIDHex, "x-b3-spanid": spanIDHex, "x-b3-flags": "1",
+		}},
+		"no span context": {ctx: context.Background(), encoding: B3MultipleHeader, expected: map[string]string{}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			carrier := propagation.MapCarrier{}
+			B3{InjectEncoding: tc.encoding}.Inject(tc.ctx, carrier)
+			assert.Must(t).Equal(tc.expected, map[string]string(carrier))
+		})
+	}
+}
+
+func TestB3_roundTrip(t *testing.T) {
+	propagator := propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, B3{InjectEncoding: B3SingleHeader})
+	carrier := propagation.MapCarrier{"b3": traceID64Hex + "-" + spanIDHex + "-d"}
+	ctx := propagator.Extract(context.Background(), carrier)
+
+	out := propagation.MapCarrier{}
+	propagator.Inject(ctx, out)
+	assert.Must(t).Equal("0000000000000000"+traceID64Hex+"-"+spanIDHex+"-d", out.Get("b3"))
+	assert.Must(t).Equal("00-0000000000000000"+traceID64Hex+"-"+spanIDHex+"-01", out.Get("traceparent"))
+}
@@ -0,0 +1,167 @@
+package propagators
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	jaegerHeader        = "uber-trace-id"
+	jaegerBaggagePrefix = "uberctx-"
+
+	jaegerFlagSampled = 0x01
+	jaegerFlagDebug   = 0x02
+)
+
+var (
+	errJaegerMalformed       = errors.New("jaeger: malformed uber-trace-id")
+	errJaegerInvalidTraceID  = errors.New("jaeger: invalid trace ID")
+	errJaegerInvalidSpanID   = errors.New("jaeger: invalid span ID")
+	errJaegerInvalidParentID = errors.New("jaeger: invalid parent span ID")
+	errJaegerInvalidFlags    = errors.New("jaeger: invalid flags")
+)
+
+// Jaeger propagates the span context in the uber-trace-id header of the Jaeger clients,
+// "{trace-id}:{span-id}:{parent-span-id}:{flags}", and the baggage in the uberctx-{key} headers.
+// Trace and span IDs without their leading zeros are left-padded, and the value may be URL encoded.
+//
+// The deprecated parent span ID is checked but not kept, and is injected as "0".
+// The debug flag is kept in the context, see ContextWithJaegerDebug, and implies the sampled flag.
+// The uberctx-* headers are merged into the baggage of the context, and every baggage member is injected as one.
+type Jaeger struct{}
+
+var _ propagation.TextMapPropagator = Jaeger{}
+
+type jaegerDebugKey struct{}
+
+// ContextWithJaegerDebug marks the trace of ctx as forced to be sampled with the Jaeger debug flag.
+func ContextWithJaegerDebug(ctx context.Context, debug bool) context.Context {
+	return context.WithValue(ctx, jaegerDebugKey{}, debug)
+}
+
+// JaegerDebugFromContext tells whether the trace of ctx has the Jaeger debug flag.
+func JaegerDebugFromContext(ctx context.Context) bool {
+	debug, _ := ctx.Value(jaegerDebugKey{}).(bool)
+	return debug
+}
+
+func (Jaeger) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	for _, m := range baggage.FromContext(ctx).Members() {
+		carrier.Set(jaegerBaggagePrefix+m.Key(), url.QueryEscape(m.Value()))
+	}
+
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	var flags int
+	if sc.IsSampled() {
+		flags |= jaegerFlagSampled
+	}
+	if JaegerDebugFromContext(ctx) {
+		flags |= jaegerFlagDebug | jaegerFlagSampled
+	}
+	carrier.Set(jaegerHeader, fmt.Sprintf("%s:%s:0:%x", sc.TraceID(), sc.SpanID(), flags))
+}
+
+func (Jaeger) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	ctx = extractJaegerBaggage(ctx, carrier)
+
+	h := carrier.Get(jaegerHeader)
+	if h == "" {
+		return ctx
+	}
+	sc, debug, err := parseJaeger(h)
+	if err != nil {
+		return ctx
+	}
+	if debug {
+		ctx = ContextWithJaegerDebug(ctx, true)
+	}
+	return trace.ContextWithRemoteSpanContext(ctx, sc)
+}
+
+func (Jaeger) Fields() []string {
+	return []string{jaegerHeader}
+}
+
+// extractJaegerBaggage adds the uberctx-* entries of carrier to the baggage of ctx.
+// The keys are case-insensitive, as the carrier may be HTTP headers, and the invalid entries are dropped.
+func extractJaegerBaggage(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	bag := baggage.FromContext(ctx)
+	changed := false
+	for _, k := range carrier.Keys() {
+		if len(k) <= len(jaegerBaggagePrefix) || !strings.EqualFold(k[:len(jaegerBaggagePrefix)], jaegerBaggagePrefix) {
+			continue
+		}
+		value, err := url.QueryUnescape(carrier.Get(k))
+		if err != nil {
+			continue
+		}
+		m, err := baggage.NewMember(strings.ToLower(k[len(jaegerBaggagePrefix):]), value)
+		if err != nil {
+			continue
+		}
+		if b, err := bag.SetMember(m); err == nil {
+			bag, changed = b, true
+		}
+	}
+	if !changed {
+		return ctx
+	}
+	return baggage.ContextWithBaggage(ctx, bag)
+}
+
+// parseJaeger parses "{trace-id}:{span-id}:{parent-span-id}:{flags}", and tells whether the debug flag is set.
+func parseJaeger(h string) (trace.SpanContext, bool, error) {
+	if unescaped, err := url.QueryUnescape(h); err == nil {
+		h = unescaped
+	}
+	parts := strings.Split(h, ":")
+	if len(parts) != 4 {
+		return trace.SpanContext{}, false, errJaegerMalformed
+	}
+
+	var (
+		scc trace.SpanContextConfig
+		err error
+	)
+	traceID, spanID, parentSpanID, flags := parts[0], parts[1], parts[2], parts[3]
+	if traceID == "" || len(traceID) > 32 || !isLowerHex(traceID) {
+		return trace.SpanContext{}, false, errJaegerInvalidTraceID
+	}
+	if scc.TraceID, err = trace.TraceIDFromHex(strings.Repeat("0", 32-len(traceID)) + traceID); err != nil {
+		return trace.SpanContext{}, false, errJaegerInvalidTraceID
+	}
+	if spanID == "" || len(spanID) > 16 || !isLowerHex(spanID) {
+		return trace.SpanContext{}, false, errJaegerInvalidSpanID
+	}
+	if scc.SpanID, err = trace.SpanIDFromHex(strings.Repeat("0", 16-len(spanID)) + spanID); err != nil {
+		return trace.SpanContext{}, false, errJaegerInvalidSpanID
+	}
+	if parentSpanID == "" || len(parentSpanID) > 16 || !isLowerHex(parentSpanID) {
+		return trace.SpanContext{}, false, errJaegerInvalidParentID
+	}
+	if flags == "" || len(flags) > 2 || !isLowerHex(flags) {
+		return trace.SpanContext{}, false, errJaegerInvalidFlags
+	}
+	f, err := strconv.ParseUint(flags, 16, 8)
+	if err != nil {
+		return trace.SpanContext{}, false, errJaegerInvalidFlags
+	}
+
+	debug := f&jaegerFlagDebug != 0
+	if f&jaegerFlagSampled != 0 || debug {
+		scc.TraceFlags = trace.FlagsSampled
+	}
+	scc.Remote = true
+	return trace.NewSpanContext(scc), debug, nil
+}
@@ -0,0 +1,113 @@
+package propagators
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/adamluzsi/testcase/assert"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestJaeger_Extract(t *testing.T) {
+	for name, tc := range map[string]struct {
+		header  string
+		traceID trace.TraceID
+		sampled bool
+		debug   bool
+		invalid bool
+	}{
+		"sampled":                       {header: traceIDHex + ":" + spanIDHex + ":0:1", traceID: traceID, sampled: true},
+		"not sampled":                   {header: traceIDHex + ":" + spanIDHex + ":0:0", traceID: traceID},
+		"with parent span ID":           {header: traceIDHex + ":" + spanIDHex + ":" + parentIDHex + ":1", traceID: traceID, sampled: true},
+		"debug implies sampled":         {header: traceIDHex + ":" + spanIDHex + ":0:2", traceID: traceID, sampled: true, debug: true},
+		"sampled and debug":             {header: traceIDHex + ":" + spanIDHex + ":0:3", traceID: traceID, sampled: true, debug: true},
+		"64-bit trace ID":               {header: traceID64Hex + ":" + spanIDHex + ":0:1", traceID: traceID64, sampled: true},
+		"leading zeros are stripped":    {header: "a3ce929d0e0e4736:f067aa0ba902b7:0:1", traceID: traceID64, sampled: true},
+		"URL encoded":                   {header: traceIDHex + "%3A" + spanIDHex + "%3A0%3A1", traceID: traceID, sampled: true},
+		"missing field":                 {header: traceIDHex + ":" + spanIDHex + ":1", invalid: true},
+		"too long trace ID":             {header: "0" + traceIDHex + ":" + spanIDHex + ":0:1", invalid: true},
+		"invalid span ID":               {header: traceIDHex + ":xyz:0:1", invalid: true},
+		"empty parent span ID":          {header: traceIDHex + ":" + spanIDHex + "::1", invalid: true},
+		"invalid flags":                 {header: traceIDHex + ":" + spanIDHex + ":0:zz", invalid: true},
+		"all-zero trace ID":             {header: "0:" + spanIDHex + ":0:1", invalid: true},
+		"uppercase trace ID is refused": {header: "4BF92F3577B34DA6A3CE929D0E0E4736:" + spanIDHex + ":0:1", invalid: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := Jaeger{}.Extract(context.Background(), propagation.MapCarrier{"uber-trace-id": tc.header})
+			sc := trace.SpanContextFromContext(ctx)
+			if tc.invalid {
+				assert.Must(t).False(sc.IsValid())
+				return
+			}
+			assert.Must(t).True(sc.IsValid())
+			assert.Must(t).True(sc.IsRemote())
+			assert.Must(t).Equal(tc.traceID, sc.TraceID())
+			assert.Must(t).Equal(spanID, sc.SpanID())
+			assert.Must(t).Equal(tc.sampled, sc.IsSampled())
+			assert.Must(t).Equal(tc.debug, JaegerDebugFromContext(ctx))
+		})
+	}
+}
+
+func TestJaeger_Inject(t *testing.T) {
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	t.Run("sampled", func(t *testing.T) {
+		carrier := propagation.MapCarrier{}
+		Jaeger{}.Inject(ctx, carrier)
+		assert.Must(t).Equal(map[string]string{"uber-trace-id": traceIDHex + ":" + spanIDHex + ":0:1"}, map[string]string(carrier))
+	})
+
+	t.Run("debug", func(t *testing.T) {
+		carrier := propagation.MapCarrier{}
+		Jaeger{}.Inject(ContextWithJaegerDebug(ctx, true), carrier)
+		assert.Must(t).Equal(traceIDHex+":"+spanIDHex+":0:3", carrier.Get("uber-trace-id"))
+	})
+
+	t.Run("baggage is injected as uberctx headers", func(t *testing.T) {
+		bag, err := baggage.Parse("user=alice,path=checkout/pay")
+		assert.Must(t).Nil(err)
+		carrier := propagation.MapCarrier{}
+		Jaeger{}.Inject(baggage.ContextWithBaggage(context.Background(), bag), carrier)
+		assert.Must(t).Equal(map[string]string{"uberctx-user": "alice", "uberctx-path": "checkout%2Fpay"}, map[string]string(carrier))
+	})
+}
+
+func TestJaeger_baggage(t *testing.T) {
+	t.Run("uberctx headers are merged into the baggage", func(t *testing.T) {
+		existing, err := baggage.Parse("tenant=acme")
+		assert.Must(t).Nil(err)
+		header := http.Header{}
+		header.Set("Uberctx-User", "alice")
+		header.Set("Uberctx-Request", "checkout%2Fpay")
+		header.Set("Uberctx-Bad(key)", "dropped")
+
+		ctx := Jaeger{}.Extract(baggage.ContextWithBaggage(context.Background(), existing), propagation.HeaderCarrier(header))
+		bag := baggage.FromContext(ctx)
+		assert.Must(t).Equal(3, bag.Len())
+		assert.Must(t).Equal("acme", bag.Member("tenant").Value())
+		assert.Must(t).Equal("alice", bag.Member("user").Value())
+		assert.Must(t).Equal("checkout/pay", bag.Member("request").Value())
+		assert.Must(t).False(trace.SpanContextFromContext(ctx).IsValid())
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		in := propagation.MapCarrier{
+			"uber-trace-id": traceIDHex + ":" + spanIDHex + ":" + parentIDHex + ":1",
+			"uberctx-user":  "alice",
+		}
+		out := propagation.MapCarrier{}
+		Jaeger{}.Inject(Jaeger{}.Extract(context.Background(), in), out)
+		assert.Must(t).Equal(map[string]string{
+			"uber-trace-id": traceIDHex + ":" + spanIDHex + ":0:1",
+			"uberctx-user":  "alice",
+		}, map[string]string(out))
+	})
+}
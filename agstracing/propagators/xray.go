@@ -0,0 +1,129 @@
+package propagators
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	xrayHeader = "x-amzn-trace-id"
+
+	xrayRootKey    = "Root"
+	xrayParentKey  = "Parent"
+	xraySampledKey = "Sampled"
+
+	xrayTraceIDVersion = "1"
+)
+
+var (
+	errXRayInvalidRoot    = errors.New("xray: invalid root trace ID")
+	errXRayInvalidParent  = errors.New("xray: invalid parent span ID")
+	errXRayInvalidSampled = errors.New("xray: invalid sampling decision")
+	errXRayMissingField   = errors.New("xray: missing root or parent")
+)
+
+// XRay propagates the span context in the X-Amzn-Trace-Id header of AWS X-Ray,
+// like "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1".
+// The root is the version, the epoch seconds in 8 hex digits and 24 random hex digits,
+// which make up the 32 hex digits of the trace ID once the dashes are removed.
+//
+// The other fields, like Self or Lineage, are ignored. A header without Parent, like the one an
+// AWS load balancer sends when it starts the trace, has no span context to extract.
+// An unknown ("?") or missing sampling decision is extracted as not sampled.
+//
+// The trace IDs of XRayIDGenerator are accepted by X-Ray, unlike the random ones.
+type XRay struct{}
+
+var _ propagation.TextMapPropagator = XRay{}
+
+func (XRay) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	tid := sc.TraceID().String()
+	sampled := "0"
+	if sc.IsSampled() {
+		sampled = "1"
+	}
+	carrier.Set(xrayHeader, xrayRootKey+"="+xrayTraceIDVersion+"-"+tid[:8]+"-"+tid[8:]+
+		";"+xrayParentKey+"="+sc.SpanID().String()+
+		";"+xraySampledKey+"="+sampled)
+}
+
+func (XRay) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	h := carrier.Get(xrayHeader)
+	if h == "" {
+		return ctx
+	}
+	sc, err := parseXRay(h)
+	if err != nil {
+		return ctx
+	}
+	return trace.ContextWithRemoteSpanContext(ctx, sc)
+}
+
+func (XRay) Fields() []string {
+	return []string{xrayHeader}
+}
+
+// parseXRay parses the ";" separated key=value fields of the X-Amzn-Trace-Id header.
+func parseXRay(h string) (trace.SpanContext, error) {
+	var (
+		scc                trace.SpanContextConfig
+		hasRoot, hasParent bool
+		err                error
+	)
+	for _, field := range strings.Split(h, ";") {
+		k, v, _ := strings.Cut(strings.TrimSpace(field), "=")
+		switch k {
+		case xrayRootKey:
+			if scc.TraceID, err = parseXRayRoot(v); err != nil {
+				return trace.SpanContext{}, err
+			}
+			hasRoot = true
+		case xrayParentKey:
+			if len(v) != 16 || !isLowerHex(v) {
+				return trace.SpanContext{}, errXRayInvalidParent
+			}
+			if scc.SpanID, err = trace.SpanIDFromHex(v); err != nil {
+				return trace.SpanContext{}, errXRayInvalidParent
+			}
+			hasParent = true
+		case xraySampledKey:
+			switch v {
+			case "1":
+				scc.TraceFlags = trace.FlagsSampled
+			case "0", "?":
+			default:
+				return trace.SpanContext{}, errXRayInvalidSampled
+			}
+		}
+	}
+	if !hasRoot || !hasParent {
+		return trace.SpanContext{}, errXRayMissingField
+	}
+	scc.Remote = true
+	return trace.NewSpanContext(scc), nil
+}
+
+// parseXRayRoot parses "1-{8 hex digits}-{24 hex digits}" into a trace ID.
+func parseXRayRoot(root string) (trace.TraceID, error) {
+	parts := strings.Split(root, "-")
+	if len(parts) != 3 || parts[0] != xrayTraceIDVersion || len(parts[1]) != 8 || len(parts[2]) != 24 {
+		return trace.TraceID{}, errXRayInvalidRoot
+	}
+	hex := parts[1] + parts[2]
+	if !isLowerHex(hex) {
+		return trace.TraceID{}, errXRayInvalidRoot
+	}
+	tid, err := trace.TraceIDFromHex(hex)
+	if err != nil {
+		return trace.TraceID{}, errXRayInvalidRoot
+	}
+	return tid, nil
+}
@@ -0,0 +1,55 @@
+package propagators
+
+import (
+	"context"
+	crand "crypto/rand"
+	"encoding/binary"
+	"math/rand"
+	"sync"
+	"time"
+
+	traceSDK "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// XRayIDGenerator makes trace IDs that AWS X-Ray accepts: the first 4 bytes are the epoch seconds
+// of the start of the trace, and the other 12 bytes are random. Span IDs are random.
+type XRayIDGenerator struct {
+	sync.Mutex
+	randSource *rand.Rand
+	now        func() time.Time
+}
+
+var _ traceSDK.IDGenerator = (*XRayIDGenerator)(nil)
+
+// NewXRayIDGenerator returns an XRayIDGenerator seeded from crypto/rand.
+func NewXRayIDGenerator() *XRayIDGenerator {
+	var rngSeed int64
+	_ = binary.Read(crand.Reader, binary.LittleEndian, &rngSeed)
+	return &XRayIDGenerator{randSource: rand.New(rand.NewSource(rngSeed)), now: time.Now}
+}
+
+// NewIDs returns a time-prefixed trace ID and a non-zero span ID.
+func (gen *XRayIDGenerator) NewIDs(ctx context.Context) (trace.TraceID, trace.SpanID) {
+	gen.Lock()
+	defer gen.Unlock()
+	tid := trace.TraceID{}
+	binary.BigEndian.PutUint32(tid[:4], uint32(gen.now().Unix()))
+	gen.randSource.Read(tid[4:])
+	return tid, gen.newSpanID()
+}
+
+// NewSpanID returns a non-zero span ID from a randomly-chosen sequence.
+func (gen *XRayIDGenerator) NewSpanID(ctx context.Context, traceID trace.TraceID) trace.SpanID {
+	gen.Lock()
+	defer gen.Unlock()
+	return gen.newSpanID()
+}
+
+func (gen *XRayIDGenerator) newSpanID() trace.SpanID {
+	sid := trace.SpanID{}
+	for !sid.IsValid() {
+		gen.randSource.Read(sid[:])
+	}
+	return sid
+}
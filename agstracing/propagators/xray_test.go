@@ -0,0 +1,102 @@
+package propagators
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/adamluzsi/testcase/assert"
+	"go.opentelemetry.io/otel/propagation"
+	traceSDK "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// xrayFixture is a recorded X-Amzn-Trace-Id header, and the span context expected from it.
+type xrayFixture struct {
+	Name    string `json:"name"`
+	Header  string `json:"header"`
+	TraceID string `json:"trace_id"`
+	SpanID  string `json:"span_id"`
+	Sampled bool   `json:"sampled"`
+	Invalid bool   `json:"invalid"`
+}
+
+func loadXRayFixtures(t *testing.T) []xrayFixture {
+	data, err := os.ReadFile("testdata/xray_headers.json")
+	assert.Must(t).Nil(err)
+	var fixtures []xrayFixture
+	assert.Must(t).Nil(json.Unmarshal(data, &fixtures))
+	return fixtures
+}
+
+func TestXRay_Extract(t *testing.T) {
+	for _, f := range loadXRayFixtures(t) {
+		f := f
+		t.Run(f.Name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set("X-Amzn-Trace-Id", f.Header)
+			sc := trace.SpanContextFromContext(XRay{}.Extract(context.Background(), propagation.HeaderCarrier(header)))
+			if f.Invalid {
+				assert.Must(t).False(sc.IsValid())
+				return
+			}
+			assert.Must(t).True(sc.IsValid())
+			assert.Must(t).True(sc.IsRemote())
+			assert.Must(t).Equal(f.TraceID, sc.TraceID().String())
+			assert.Must(t).Equal(f.SpanID, sc.SpanID().String())
+			assert.Must(t).Equal(f.Sampled, sc.IsSampled())
+		})
+	}
+}
+
+func TestXRay_Inject(t *testing.T) {
+	t.Run("the recorded headers are injected back", func(t *testing.T) {
+		in := propagation.MapCarrier{"x-amzn-trace-id": "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1"}
+		out := propagation.MapCarrier{}
+		XRay{}.Inject(XRay{}.Extract(context.Background(), in), out)
+		assert.Must(t).Equal(in, out)
+	})
+
+	t.Run("not sampled", func(t *testing.T) {
+		ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID: traceID,
+			SpanID:  spanID,
+		}))
+		carrier := propagation.MapCarrier{}
+		XRay{}.Inject(ctx, carrier)
+		assert.Must(t).Equal("Root=1-4bf92f35-77b34da6a3ce929d0e0e4736;Parent="+spanIDHex+";Sampled=0", carrier.Get("x-amzn-trace-id"))
+	})
+
+	t.Run("no span context", func(t *testing.T) {
+		carrier := propagation.MapCarrier{}
+		XRay{}.Inject(context.Background(), carrier)
+		assert.Must(t).Equal(0, len(carrier))
+	})
+}
+
+func TestXRayIDGenerator(t *testing.T) {
+	gen := NewXRayIDGenerator()
+	start := time.Date(2022, 6, 9, 14, 0, 0, 0, time.UTC)
+	gen.now = func() time.Time { return start }
+
+	tid, sid := gen.NewIDs(context.Background())
+	assert.Must(t).True(tid.IsValid())
+	assert.Must(t).True(sid.IsValid())
+	assert.Must(t).Equal("62a1fce0", tid.String()[:8])
+	assert.Must(t).True(gen.NewSpanID(context.Background(), tid).IsValid())
+
+	t.Run("spans of a tracer provider get X-Ray trace IDs", func(t *testing.T) {
+		tp := traceSDK.NewTracerProvider(traceSDK.WithIDGenerator(gen))
+		_, span := tp.Tracer("test").Start(context.Background(), "span")
+		span.End()
+
+		carrier := propagation.MapCarrier{}
+		XRay{}.Inject(trace.ContextWithSpan(context.Background(), span), carrier)
+		sc := trace.SpanContextFromContext(XRay{}.Extract(context.Background(), carrier))
+		assert.Must(t).Equal(span.SpanContext().TraceID(), sc.TraceID())
+		assert.Must(t).Contain(carrier.Get("x-amzn-trace-id"), "Root=1-62a1fce0-")
+	})
+}
@@ -0,0 +1,105 @@
+package agstracing
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// LogEventName is the name of the span events made from log records.
+	LogEventName = "log"
+	// LogSeverityKey is the span event attribute with the level of the log record.
+	LogSeverityKey = attribute.Key("log.severity")
+	// LogMessageKey is the span event attribute with the message of the log record.
+	LogMessageKey = attribute.Key("log.message")
+	// LogEventsDroppedKey is the span attribute counting the log records not added as events, because of the cap.
+	LogEventsDroppedKey = attribute.Key("log.events_dropped")
+)
+
+// NewSpanEventSink writes the records to next, and also adds them as events to the recording span of their context,
+// with the message and the fields as attributes, so the logs of a request are visible inside its trace.
+//
+// Only the records from the min level on become events, and at most maxEvents per span,
+// so chatty code cannot blow up the span size. The records over the cap are counted in LogEventsDroppedKey.
+// A maxEvents of zero or less means no cap.
+func NewSpanEventSink(next Sink, min Level, maxEvents int) Sink {
+	if next == nil {
+		next = DiscardSink
+	}
+	return &spanEventSink{next: next, min: min, maxEvents: maxEvents, spans: make(map[trace.SpanID]*spanEvents)}
+}
+
+type spanEventSink struct {
+	next      Sink
+	min       Level
+	maxEvents int
+
+	mu sync.Mutex
+	// spans counts the events added to each span, until the span ended.
+	spans   map[trace.SpanID]*spanEvents
+	sweepAt int
+}
+
+type spanEvents struct {
+	span    trace.Span
+	added   int
+	dropped int
+}
+
+func (s *spanEventSink) Write(ctx context.Context, rec Record) {
+	s.next.Write(ctx, rec)
+	if rec.Level < s.min {
+		return
+	}
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+	if s.maxEvents <= 0 {
+		s.addEvent(span, rec)
+		return
+	}
+
+	s.mu.Lock()
+	events := s.track(span)
+	if events.added >= s.maxEvents {
+		events.dropped++
+		dropped := events.dropped
+		s.mu.Unlock()
+		span.SetAttributes(LogEventsDroppedKey.Int(dropped))
+		return
+	}
+	events.added++
+	s.mu.Unlock()
+	s.addEvent(span, rec)
+}
+
+func (s *spanEventSink) addEvent(span trace.Span, rec Record) {
+	attrs := make([]attribute.KeyValue, 0, len(rec.Fields)+2)
+	attrs = append(attrs, LogSeverityKey.String(rec.Level.String()), LogMessageKey.String(rec.Message))
+	attrs = append(attrs, rec.Fields...)
+	span.AddEvent(LogEventName, trace.WithTimestamp(rec.Time), trace.WithAttributes(attrs...))
+}
+
+// track returns the counters of the span, and forgets the ended spans once in a while,
+// as there is no hook telling when a span ends.
+func (s *spanEventSink) track(span trace.Span) *spanEvents {
+	id := span.SpanContext().SpanID()
+	if events, ok := s.spans[id]; ok {
+		return events
+	}
+	if len(s.spans) >= s.sweepAt {
+		for id, events := range s.spans {
+			if !events.span.IsRecording() {
+				delete(s.spans, id)
+			}
+		}
+		s.sweepAt = 2*len(s.spans) + 64
+	}
+	events := &spanEvents{span: span}
+	s.spans[id] = events
+	return events
+}
@@ -0,0 +1,75 @@
+package agstracing
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/adamluzsi/testcase/assert"
+	"go.opentelemetry.io/otel/attribute"
+	traceSDK "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestNewSpanEventSink(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := traceSDK.NewTracerProvider(traceSDK.WithSpanProcessor(recorder)).Tracer("test")
+
+	t.Run("records are written to next and added as span events", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		logger := NewLogger(NewSpanEventSink(NewWriterSink(buf, FormatLogfmt), LevelInfo, 0))
+		ctx, span := tracer.Start(context.Background(), "request")
+		logger.Info(ctx, "calling upstreams", attribute.Int("upstreams", 2))
+		span.End()
+
+		assert.Must(t).Contain(buf.String(), `msg="calling upstreams"`)
+		events := span.(traceSDK.ReadOnlySpan).Events()
+		assert.Must(t).Equal(1, len(events))
+		assert.Must(t).Equal(LogEventName, events[0].Name)
+		assert.Must(t).Equal([]attribute.KeyValue{
+			LogSeverityKey.String("info"),
+			LogMessageKey.String("calling upstreams"),
+			attribute.Int("upstreams", 2),
+		}, events[0].Attributes)
+	})
+
+	t.Run("records below the threshold are not added", func(t *testing.T) {
+		logger := NewLogger(NewSpanEventSink(nil, LevelWarn, 0), WithMinLevel(LevelDebug))
+		ctx, span := tracer.Start(context.Background(), "request")
+		logger.Info(ctx, "chatty")
+		logger.Warn(ctx, "important")
+		span.End()
+		events := span.(traceSDK.ReadOnlySpan).Events()
+		assert.Must(t).Equal(1, len(events))
+		assert.Must(t).Equal(LogMessageKey.String("important"), events[0].Attributes[1])
+	})
+
+	t.Run("events are capped per span, and the dropped ones are counted", func(t *testing.T) {
+		logger := NewLogger(NewSpanEventSink(nil, LevelInfo, 2))
+		ctx1, span1 := tracer.Start(context.Background(), "first")
+		ctx2, span2 := tracer.Start(context.Background(), "second")
+		for i := 0; i < 5; i++ {
+			logger.Info(ctx1, "chatty")
+		}
+		logger.Info(ctx2, "quiet")
+		span1.End()
+		span2.End()
+
+		first := span1.(traceSDK.ReadOnlySpan)
+		assert.Must(t).Equal(2, len(first.Events()))
+		var dropped int64
+		for _, attr := range first.Attributes() {
+			if attr.Key == LogEventsDroppedKey {
+				dropped = attr.Value.AsInt64()
+			}
+		}
+		assert.Must(t).Equal(int64(3), dropped)
+		assert.Must(t).Equal(1, len(span2.(traceSDK.ReadOnlySpan).Events()))
+	})
+
+	t.Run("records without a recording span are only written to next", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		NewLogger(NewSpanEventSink(NewWriterSink(buf, FormatLogfmt), LevelInfo, 1)).Info(context.Background(), "no span")
+		assert.Must(t).Contain(buf.String(), `msg="no span"`)
+	})
+}
@@ -0,0 +1,139 @@
+package agstracing
+
+import (
+	"errors"
+	"fmt"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceparentLength is the length of "version-traceid-spanid-flags", the whole of a version 00 traceparent.
+const traceparentLength = 2 + 1 + 32 + 1 + 16 + 1 + 2
+
+// ParseMode decides how ParseTraceparent treats the versions after 00.
+type ParseMode int
+
+const (
+	// ParseModeLenient parses the versions after 00 like the W3C Trace Context asks:
+	// their first four fields are read as in version 00, and the fields they append are ignored.
+	// This is the default.
+	ParseModeLenient ParseMode = iota
+	// ParseModeStrict rejects every version but 00.
+	ParseModeStrict
+)
+
+var (
+	// ErrTraceparentMalformed is reported when the header is too short or its fields are not separated by dashes.
+	ErrTraceparentMalformed = errors.New("malformed traceparent")
+	// ErrTraceparentVersion is reported when the version is not two lowercase hex digits.
+	ErrTraceparentVersion = errors.New("invalid traceparent version")
+	// ErrTraceparentVersionFF is reported for the version ff, which the W3C Trace Context forbids.
+	ErrTraceparentVersionFF = errors.New("forbidden traceparent version ff")
+	// ErrTraceparentUnsupportedVersion is reported in ParseModeStrict for the versions after 00.
+	ErrTraceparentUnsupportedVersion = errors.New("unsupported traceparent version")
+	// ErrTraceparentTrailingData is reported when a version 00 header goes on after its flags.
+	ErrTraceparentTrailingData = errors.New("trailing data after version 00 traceparent")
+	// ErrTraceparentTraceID is reported when the trace ID is not 32 lowercase hex digits.
+	ErrTraceparentTraceID = errors.New("invalid traceparent trace ID")
+	// ErrTraceparentZeroTraceID is reported for an all-zero trace ID.
+	ErrTraceparentZeroTraceID = errors.New("all-zero traceparent trace ID")
+	// ErrTraceparentSpanID is reported when the parent span ID is not 16 lowercase hex digits.
+	ErrTraceparentSpanID = errors.New("invalid traceparent span ID")
+	// ErrTraceparentZeroSpanID is reported for an all-zero parent span ID.
+	ErrTraceparentZeroSpanID = errors.New("all-zero traceparent span ID")
+	// ErrTraceparentFlags is reported when the flags are not two lowercase hex digits.
+	ErrTraceparentFlags = errors.New("malformed traceparent flags")
+)
+
+// TraceparentError is the error of ParseTraceparent.
+// It wraps one of the ErrTraceparent* errors, which tells why the header was rejected.
+type TraceparentError struct {
+	// Value is the rejected header value.
+	Value string
+	Err   error
+}
+
+func (e *TraceparentError) Error() string { return fmt.Sprintf("%v: %q", e.Err, e.Value) }
+func (e *TraceparentError) Unwrap() error { return e.Err }
+
+// ParseTraceparent parses a W3C traceparent header value,
+// like "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", into a remote span context.
+// Only the sampled flag is kept, as the other flags are not known to the version 00.
+//
+// When the value is rejected, the error is a *TraceparentError.
+func ParseTraceparent(v string, mode ParseMode) (trace.SpanContext, error) {
+	fail := func(err error) (trace.SpanContext, error) {
+		return trace.SpanContext{}, &TraceparentError{Value: v, Err: err}
+	}
+	if len(v) < traceparentLength {
+		return fail(ErrTraceparentMalformed)
+	}
+	var version [1]byte
+	if !decodeLowerHex(version[:], v[0:2]) {
+		return fail(ErrTraceparentVersion)
+	}
+	if version[0] == 0xff {
+		return fail(ErrTraceparentVersionFF)
+	}
+	if v[2] != '-' || v[35] != '-' || v[52] != '-' {
+		return fail(ErrTraceparentMalformed)
+	}
+	switch {
+	case version[0] == 0 && len(v) != traceparentLength:
+		return fail(ErrTraceparentTrailingData)
+	case version[0] != 0 && mode == ParseModeStrict:
+		return fail(ErrTraceparentUnsupportedVersion)
+	case len(v) > traceparentLength && v[traceparentLength] != '-':
+		return fail(ErrTraceparentMalformed)
+	}
+
+	var (
+		scc   = trace.SpanContextConfig{Remote: true}
+		flags [1]byte
+	)
+	if !decodeLowerHex(scc.TraceID[:], v[3:35]) {
+		return fail(ErrTraceparentTraceID)
+	}
+	if !scc.TraceID.IsValid() {
+		return fail(ErrTraceparentZeroTraceID)
+	}
+	if !decodeLowerHex(scc.SpanID[:], v[36:52]) {
+		return fail(ErrTraceparentSpanID)
+	}
+	if !scc.SpanID.IsValid() {
+		return fail(ErrTraceparentZeroSpanID)
+	}
+	if !decodeLowerHex(flags[:], v[53:55]) {
+		return fail(ErrTraceparentFlags)
+	}
+	scc.TraceFlags = trace.TraceFlags(flags[0]) & trace.FlagsSampled
+	return trace.NewSpanContext(scc), nil
+}
+
+// decodeLowerHex decodes src into dst, which is half its length,
+// and refuses the uppercase digits that encoding/hex accepts.
+func decodeLowerHex(dst []byte, src string) bool {
+	for i := range dst {
+		hi, ok := fromLowerHex(src[2*i])
+		if !ok {
+			return false
+		}
+		lo, ok := fromLowerHex(src[2*i+1])
+		if !ok {
+			return false
+		}
+		dst[i] = hi<<4 | lo
+	}
+	return true
+}
+
+func fromLowerHex(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,77 @@
+package agstracing
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/adamluzsi/testcase/assert"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	const (
+		traceID = "0af7651916cd43dd8448eb211c80319c"
+		spanID  = "b7ad6b7169203331"
+	)
+
+	for name, tc := range map[string]struct {
+		value   string
+		mode    ParseMode
+		err     error
+		sampled bool
+	}{
+		"sampled":                        {value: "00-" + traceID + "-" + spanID + "-01", sampled: true},
+		"not sampled":                    {value: "00-" + traceID + "-" + spanID + "-00"},
+		"unknown flags are dropped":      {value: "00-" + traceID + "-" + spanID + "-09", sampled: true},
+		"future version":                 {value: "01-" + traceID + "-" + spanID + "-01", sampled: true},
+		"future version with new fields": {value: "cc-" + traceID + "-" + spanID + "-01-what-the-future-holds", sampled: true},
+		"future version in strict mode":  {value: "01-" + traceID + "-" + spanID + "-01", mode: ParseModeStrict, err: ErrTraceparentUnsupportedVersion},
+		"version 00 in strict mode":      {value: "00-" + traceID + "-" + spanID + "-01", mode: ParseModeStrict, sampled: true},
+		"empty":                          {value: "", err: ErrTraceparentMalformed},
+		"too short":                      {value: "00-" + traceID + "-" + spanID + "-1", err: ErrTraceparentMalformed},
+		"wrong separator":                {value: "00_" + traceID + "-" + spanID + "-01", err: ErrTraceparentMalformed},
+		"future version glued to data":   {value: "01-" + traceID + "-" + spanID + "-01x", err: ErrTraceparentMalformed},
+		"bad version":                    {value: "0x-" + traceID + "-" + spanID + "-01", err: ErrTraceparentVersion},
+		"uppercase version":              {value: "0A-" + traceID + "-" + spanID + "-01", err: ErrTraceparentVersion},
+		"version ff":                     {value: "ff-" + traceID + "-" + spanID + "-01", err: ErrTraceparentVersionFF},
+		"trailing data on version 00":    {value: "00-" + traceID + "-" + spanID + "-01-extra", err: ErrTraceparentTrailingData},
+		"uppercase trace ID":             {value: "00-0AF7651916CD43DD8448EB211C80319C-" + spanID + "-01", err: ErrTraceparentTraceID},
+		"all-zero trace ID":              {value: "00-00000000000000000000000000000000-" + spanID + "-01", err: ErrTraceparentZeroTraceID},
+		"invalid span ID":                {value: "00-" + traceID + "-b7ad6b716920333g-01", err: ErrTraceparentSpanID},
+		"all-zero span ID":               {value: "00-" + traceID + "-0000000000000000-01", err: ErrTraceparentZeroSpanID},
+		"malformed flags":                {value: "00-" + traceID + "-" + spanID + "-0g", err: ErrTraceparentFlags},
+	} {
+		t.Run(name, func(t *testing.T) {
+			sc, err := ParseTraceparent(tc.value, tc.mode)
+			if tc.err != nil {
+				assert.Must(t).True(errors.Is(err, tc.err), err)
+				var tpErr *TraceparentError
+				assert.Must(t).True(errors.As(err, &tpErr))
+				assert.Must(t).Equal(tc.value, tpErr.Value)
+				assert.Must(t).False(sc.IsValid())
+				return
+			}
+			assert.Must(t).Nil(err)
+			assert.Must(t).True(sc.IsRemote())
+			assert.Must(t).Equal(traceID, sc.TraceID().String())
+			assert.Must(t).Equal(spanID, sc.SpanID().String())
+			assert.Must(t).Equal(tc.sampled, sc.IsSampled())
+		})
+	}
+
+	t.Run("round trip with FormatTraceparent", func(t *testing.T) {
+		const v = "00-" + traceID + "-" + spanID + "-01"
+		sc, err := ParseTraceparent(v, ParseModeStrict)
+		assert.Must(t).Nil(err)
+		assert.Must(t).Equal(v, FormatTraceparent(sc))
+	})
+}
+
+func BenchmarkParseTraceparent(b *testing.B) {
+	const v = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseTraceparent(v, ParseModeLenient); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package agstracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// ErrTraceStateKey is reported for a key outside of the W3C tracestate grammar, like "Ags" or "1ags".
+	ErrTraceStateKey = errors.New("invalid tracestate key")
+	// ErrTraceStateValue is reported for a value outside of the W3C tracestate grammar,
+	// like an empty value, one with "," or "=", or one longer than 256 characters.
+	ErrTraceStateValue = errors.New("invalid tracestate value")
+	// ErrNoSpanContext is reported when the tracestate of a context without a valid span context is edited.
+	ErrNoSpanContext = errors.New("no span context")
+)
+
+// LookupTraceState returns the value of the tracestate entry of key, from the span in ctx.
+func LookupTraceState(ctx context.Context, key string) (string, bool) {
+	sc, ok := lookupSpanContext(ctx)
+	if !ok {
+		return "", false
+	}
+	v := sc.TraceState().Get(key)
+	return v, v != ""
+}
+
+// TraceStateVendor edits the tracestate entry of a vendor key owned by this service,
+// and leaves the entries of the other vendors as they arrived.
+//
+// The edits return a context whose span context has the new tracestate,
+// so it is injected by the propagators and inherited by the child spans,
+// while the span of the context keeps recording as before.
+type TraceStateVendor struct {
+	key string
+}
+
+// NewTraceStateVendor checks that key follows the W3C tracestate grammar, like "ags" or "ags@tenant".
+func NewTraceStateVendor(key string) (TraceStateVendor, error) {
+	if !isTraceStateKey(key) {
+		return TraceStateVendor{}, fmt.Errorf("%w: %q", ErrTraceStateKey, key)
+	}
+	return TraceStateVendor{key: key}, nil
+}
+
+// Key returns the vendor key.
+func (v TraceStateVendor) Key() string { return v.key }
+
+// Value returns the value of the vendor entry, from the span in ctx.
+func (v TraceStateVendor) Value(ctx context.Context) (string, bool) {
+	return LookupTraceState(ctx, v.key)
+}
+
+// Upsert sets the vendor entry and moves it to the front of the tracestate, as the W3C Trace Context asks
+// of the vendors that update their entry. When the tracestate already has 32 entries, the right-most one is dropped.
+func (v TraceStateVendor) Upsert(ctx context.Context, value string) (context.Context, error) {
+	sc, ok := lookupSpanContext(ctx)
+	if !ok {
+		return ctx, ErrNoSpanContext
+	}
+	if !isTraceStateValue(value) {
+		return ctx, fmt.Errorf("%w: %q", ErrTraceStateValue, value)
+	}
+	ts, err := sc.TraceState().Insert(v.key, value)
+	if err != nil {
+		return ctx, err
+	}
+	return contextWithTraceState(ctx, sc.WithTraceState(ts)), nil
+}
+
+// Delete removes the vendor entry from the tracestate.
+func (v TraceStateVendor) Delete(ctx context.Context) context.Context {
+	sc, ok := lookupSpanContext(ctx)
+	if !ok || sc.TraceState().Get(v.key) == "" {
+		return ctx
+	}
+	return contextWithTraceState(ctx, sc.WithTraceState(sc.TraceState().Delete(v.key)))
+}
+
+// traceStateSpan is the span of a context whose tracestate was edited.
+// Only its span context differs from the span it wraps, as the span context of a started span cannot change.
+type traceStateSpan struct {
+	trace.Span
+	sc trace.SpanContext
+}
+
+func (s traceStateSpan) SpanContext() trace.SpanContext { return s.sc }
+
+func contextWithTraceState(ctx context.Context, sc trace.SpanContext) context.Context {
+	span := trace.SpanFromContext(ctx)
+	if edited, ok := span.(traceStateSpan); ok {
+		span = edited.Span
+	}
+	return trace.ContextWithSpan(ctx, traceStateSpan{Span: span, sc: sc})
+}
+
+// isTraceStateKey tells whether key is a simple key, lcalpha followed by up to 255 key characters,
+// or a multi-tenant one, "tenant@system", where the tenant starts with lcalpha or a digit and has up to 241 characters,
+// and the system starts with lcalpha and has up to 14 characters.
+func isTraceStateKey(key string) bool {
+	tenant, system, multiTenant := strings.Cut(key, "@")
+	if !multiTenant {
+		return len(key) <= 256 && isTraceStateKeyPart(key, false)
+	}
+	return len(tenant) <= 241 && isTraceStateKeyPart(tenant, true) &&
+		len(system) <= 14 && isTraceStateKeyPart(system, false)
+}
+
+func isTraceStateKeyPart(s string, digitFirst bool) bool {
+	if s == "" || !('a' <= s[0] && s[0] <= 'z' || digitFirst && '0' <= s[0] && s[0] <= '9') {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '_' || c == '-' || c == '*' || c == '/') {
+			return false
+		}
+	}
+	return true
+}
+
+// isTraceStateValue tells whether value has 1 to 256 printable ASCII characters but "," and "=",
+// and does not end with a space.
+func isTraceStateValue(value string) bool {
+	if value == "" || len(value) > 256 || value[len(value)-1] == ' ' {
+		return false
+	}
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c < 0x20 || c > 0x7e || c == ',' || c == '=' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,124 @@
+package agstracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/adamluzsi/testcase/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	traceSDK "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestNewTraceStateVendor(t *testing.T) {
+	for _, key := range []string{"ags", "a", "ags_1-2*3/4", "tenant@ags", "0tenant@ags", strings.Repeat("a", 256)} {
+		_, err := NewTraceStateVendor(key)
+		assert.Must(t).Nil(err, key)
+	}
+	for _, key := range []string{"", "Ags", "1ags", "ags!", "@ags", "tenant@", "tenant@1ags", "tenant@ags@x",
+		strings.Repeat("a", 257), strings.Repeat("a", 242) + "@ags", "tenant@" + strings.Repeat("a", 15)} {
+		_, err := NewTraceStateVendor(key)
+		assert.Must(t).True(errors.Is(err, ErrTraceStateKey), key)
+	}
+}
+
+func TestTraceStateVendor(t *testing.T) {
+	vendor, err := NewTraceStateVendor("ags")
+	assert.Must(t).Nil(err)
+	remote := func(t *testing.T, tracestate string) context.Context {
+		ts, err := trace.ParseTraceState(tracestate)
+		assert.Must(t).Nil(err)
+		return trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    trace.TraceID{0x01},
+			SpanID:     trace.SpanID{0x01},
+			TraceFlags: trace.FlagsSampled,
+			TraceState: ts,
+		}))
+	}
+	tracestate := func(ctx context.Context) string { return trace.SpanContextFromContext(ctx).TraceState().String() }
+
+	t.Run("upsert adds the entry to the front", func(t *testing.T) {
+		ctx, err := vendor.Upsert(remote(t, "rojo=00f067aa0ba902b7,congo=t61rcWkgMzE"), "sampled:1")
+		assert.Must(t).Nil(err)
+		assert.Must(t).Equal("ags=sampled:1,rojo=00f067aa0ba902b7,congo=t61rcWkgMzE", tracestate(ctx))
+		value, ok := vendor.Value(ctx)
+		assert.Must(t).True(ok)
+		assert.Must(t).Equal("sampled:1", value)
+		congo, ok := LookupTraceState(ctx, "congo")
+		assert.Must(t).True(ok)
+		assert.Must(t).Equal("t61rcWkgMzE", congo)
+	})
+
+	t.Run("upsert moves the updated entry to the front", func(t *testing.T) {
+		ctx, err := vendor.Upsert(remote(t, "rojo=1,ags=old,congo=2"), "new")
+		assert.Must(t).Nil(err)
+		assert.Must(t).Equal("ags=new,rojo=1,congo=2", tracestate(ctx))
+	})
+
+	t.Run("the right-most entry is dropped beyond 32 entries", func(t *testing.T) {
+		entries := make([]string, 32)
+		for i := range entries {
+			entries[i] = fmt.Sprintf("v%d=%d", i, i)
+		}
+		ctx, err := vendor.Upsert(remote(t, strings.Join(entries, ",")), "1")
+		assert.Must(t).Nil(err)
+		ts := trace.SpanContextFromContext(ctx).TraceState()
+		assert.Must(t).Equal(32, ts.Len())
+		assert.Must(t).Equal("1", ts.Get("ags"))
+		assert.Must(t).Equal("30", ts.Get("v30"))
+		assert.Must(t).Equal("", ts.Get("v31"))
+	})
+
+	t.Run("invalid values are refused", func(t *testing.T) {
+		for _, value := range []string{"", "a,b", "a=b", "trailing ", "tab\t", strings.Repeat("x", 257)} {
+			ctx := remote(t, "rojo=1")
+			edited, err := vendor.Upsert(ctx, value)
+			assert.Must(t).True(errors.Is(err, ErrTraceStateValue), value)
+			assert.Must(t).Equal(ctx, edited)
+		}
+	})
+
+	t.Run("delete removes only the vendor entry", func(t *testing.T) {
+		ctx := vendor.Delete(remote(t, "rojo=1,ags=2,congo=3"))
+		assert.Must(t).Equal("rojo=1,congo=3", tracestate(ctx))
+		_, ok := vendor.Value(ctx)
+		assert.Must(t).False(ok)
+	})
+
+	t.Run("a context without span context cannot be edited", func(t *testing.T) {
+		_, err := vendor.Upsert(context.Background(), "1")
+		assert.Must(t).True(errors.Is(err, ErrNoSpanContext))
+		assert.Must(t).Equal(context.Background(), vendor.Delete(context.Background()))
+	})
+
+	t.Run("the edited state is injected and inherited, and the span keeps recording", func(t *testing.T) {
+		recorder := tracetest.NewSpanRecorder()
+		tracer := traceSDK.NewTracerProvider(traceSDK.WithSpanProcessor(recorder)).Tracer("test")
+		ctx, span := tracer.Start(remote(t, "rojo=1"), "server")
+		ctx, err := vendor.Upsert(ctx, "a")
+		assert.Must(t).Nil(err)
+		ctx, err = vendor.Upsert(ctx, "b")
+		assert.Must(t).Nil(err)
+
+		carrier := propagation.MapCarrier{}
+		propagation.TraceContext{}.Inject(ctx, carrier)
+		assert.Must(t).Equal("ags=b,rojo=1", carrier.Get("tracestate"))
+		assert.Must(t).Contain(carrier.Get("traceparent"), span.SpanContext().SpanID().String())
+
+		_, child := tracer.Start(ctx, "client")
+		child.End()
+		assert.Must(t).Equal("ags=b,rojo=1", child.SpanContext().TraceState().String())
+		assert.Must(t).Equal(span.SpanContext().SpanID(), child.(traceSDK.ReadOnlySpan).Parent().SpanID())
+
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("k", "v"))
+		trace.SpanFromContext(ctx).End()
+		ended := recorder.Ended()
+		assert.Must(t).Equal(2, len(ended))
+		assert.Must(t).Equal([]attribute.KeyValue{attribute.String("k", "v")}, ended[1].Attributes())
+	})
+}
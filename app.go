@@ -2,83 +2,244 @@ package main
 
 import (
 	"context"
-	"fmt"
-	"log"
+	"encoding/json"
+	"errors"
 	"net/http"
-	"strings"
 
+	"github.com/mikejeuga/OTEL_training/agstracing"
+	"github.com/mikejeuga/OTEL_training/agstracing/httpadapter"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
 
 	"go.opentelemetry.io/otel/trace"
 )
 
 const name = "ASG"
 
+const traceresponseHeader = "traceresponse"
+
 type App struct {
-	l      *log.Logger
-	client *http.Client
-	host   string
+	l          *agstracing.Logger
+	client     *http.Client
+	tracer     trace.Tracer
+	upstreams  []Upstream
+	fanOutMode FanOutMode
 }
 
-func NewHTTPHandler(host string, l *log.Logger, propagator propagation.TextMapPropagator, tracerProvider trace.TracerProvider) http.Handler {
+func NewHTTPHandler(host string, l *agstracing.Logger, propagator propagation.TextMapPropagator, tracerProvider trace.TracerProvider, opts ...Option) http.Handler {
+	cfg := newConfig(opts)
+	if l != nil {
+		cfg.logger = l
+	}
+	upstreams := cfg.upstreams
+	if len(upstreams) == 0 {
+		upstreams = []Upstream{{Name: "default", Host: host}}
+	}
 	app := &App{
-		l:    l,
-		host: host,
+		l:          cfg.logger,
+		tracer:     tracerProvider.Tracer(instrumentationName, trace.WithInstrumentationVersion(instrumentationVersion())),
+		upstreams:  upstreams,
+		fanOutMode: cfg.fanOutMode,
 		client: &http.Client{
-			Transport: rtFn(func(req *http.Request) (*http.Response, error) {
-				// shovel the tracing ID from the context into the outgoing HTTP Request
-
-				// open telnet TextMap Propagator with Carrier for the round tripped request to inject headers.
-				ctx := req.Context()                 // contains the tracingID
-				carrier := HeaderCarrier(req.Header) // mapping to the outgoing headers, that will carry the tracing ID
-				propagator.Inject(ctx, carrier)      // put the tracing ID from context into the http.Header (HeaderCarrier)
-
-				sc := trace.SpanContextFromContext(ctx)
-				if !sc.IsValid() {
-					panic("boom")
-				}
-
-				//fmt.Println(trace.SpanContextFromContext(ctx).TraceID())
-				return http.DefaultTransport.RoundTrip(req)
-			}),
+			// shovel the tracing ID from the context into the outgoing HTTP Request
+			Transport: httpadapter.NewRoundTripper(http.DefaultTransport, propagator, tracerProvider,
+				append([]httpadapter.Option{httpadapter.WithClientTrace(false), httpadapter.WithDebugHook(cfg.debugHook)}, cfg.clientOptions...)...),
 		},
 	}
+	var handler http.Handler = app
+	if cfg.requestID {
+		handler = requestIDMiddleware(handler)
+	}
 	// wrap App with open telemetry middleware
-	return traceIDMiddleware(app, propagator, tracerProvider)
+	return traceIDMiddleware(handler, propagator, tracerProvider, cfg)
 }
 
-func traceIDMiddleware(next http.Handler, propagator propagation.TextMapPropagator, tracerProvider trace.TracerProvider) http.Handler {
+func traceIDMiddleware(next http.Handler, propagator propagation.TextMapPropagator, tracerProvider trace.TracerProvider, cfg config) http.Handler {
+	tracer := tracerProvider.Tracer(instrumentationName, trace.WithInstrumentationVersion(instrumentationVersion()))
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// shovel the tracing ID from the incoming HTTP request into the next HTTP Handler's request context.
-		carrier := HeaderCarrier(r.Header)              // source of truth
-		ctx := propagator.Extract(r.Context(), carrier) // creating a new context with tracing ID in it
-		fmt.Printf("%#v\n", ctx)
-		ctx, span := tracerProvider.Tracer("i.n.").Start(ctx, "example-URL-path")
+		// the request headers are the source of truth, and the extracted context carries the tracing ID.
+		carrier := debugCarrier{ctx: r.Context(), carrier: HeaderCarrier(r.Header), hook: cfg.debugHook}
+		ctx := propagator.Extract(r.Context(), carrier)
+		reportExtracted(ctx, cfg.debugHook)
+		var route string
+		if cfg.routeResolver != nil {
+			route = cfg.routeResolver(r)
+		}
+		opts := serverSpanStartOptions(r, route, cfg)
+		if cfg.trustPolicy != nil && !cfg.trustPolicy(r) {
+			cfg.debugHook.Report(ctx, agstracing.LevelInfo, "untrusted trace context is not used as parent",
+				attribute.String("remote_addr", r.RemoteAddr))
+			ctx, opts = untrustedParent(r.Context(), ctx, opts)
+		}
+		ctx, span := tracer.Start(ctx, spanName(r, route), opts...)
 		defer span.End()
-		next.ServeHTTP(w, r.WithContext(ctx)) // call next http.Handler with the context that has the tracingID
+		if traceparent, ok := agstracing.Traceparent(ctx); ok && cfg.traceResponse {
+			w.Header().Set(traceresponseHeader, traceparent)
+		}
+		rw := newResponseWriter(w)
+		if cfg.recoverPanics {
+			defer recoverPanic(span, rw, cfg.rePanic)
+		}
+		next.ServeHTTP(rw, r.WithContext(ctx)) // call next http.Handler with the context that has the tracingID
+		recordResponse(span, rw, cfg)
+		cfg.logger.Debug(ctx, "request served",
+			semconv.HTTPMethodKey.String(r.Method),
+			semconv.HTTPTargetKey.String(r.URL.RequestURI()),
+			semconv.HTTPStatusCodeKey.Int(rw.Status()),
+		)
 	})
 }
 
-type rtFn func(req *http.Request) (*http.Response, error)
+// serverSpanStartOptions describes the incoming request with the semantic conventions of an HTTP server span.
+func serverSpanStartOptions(r *http.Request, route string, cfg config) []trace.SpanStartOption {
+	opts := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(semconv.NetAttributesFromHTTPRequest("tcp", r)...),
+		trace.WithAttributes(semconv.EndUserAttributesFromHTTPRequest(r)...),
+		trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest(cfg.serverName, route, r)...),
+	}
+	for _, extract := range cfg.attributeExtractors {
+		opts = append(opts, trace.WithAttributes(extract(r)...))
+	}
+	return opts
+}
+
+// reportExtracted tells the debug hook what the propagator extracted from the incoming request.
+func reportExtracted(ctx context.Context, hook agstracing.DebugHook) {
+	if !hook.Enabled(agstracing.LevelDebug) {
+		return
+	}
+	sc := trace.SpanContextFromContext(ctx)
+	hook.Report(ctx, agstracing.LevelDebug, "extracted trace context",
+		attribute.Bool("valid", sc.IsValid()),
+		attribute.String("trace_id", sc.TraceID().String()),
+		attribute.String("span_id", sc.SpanID().String()),
+		attribute.Bool("sampled", sc.IsSampled()),
+		attribute.Int("baggage_members", baggage.FromContext(ctx).Len()),
+	)
+}
+
+// untrustedParent drops what was extracted from an untrusted caller, baggage included,
+// and makes the server span a new root that only links to the remote span context.
+func untrustedParent(ctx, extracted context.Context, opts []trace.SpanStartOption) (context.Context, []trace.SpanStartOption) {
+	opts = append(opts, trace.WithNewRoot())
+	if remote := trace.SpanContextFromContext(extracted); remote.IsValid() {
+		opts = append(opts, trace.WithLinks(trace.Link{SpanContext: remote}))
+	}
+	return ctx, opts
+}
+
+// recordResponse sets the outcome of the response written by the next http.Handler on the server span.
+func recordResponse(span trace.Span, rw *responseWriter, cfg config) {
+	span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(rw.Status())...)
+	span.SetAttributes(semconv.HTTPResponseContentLengthKey.Int64(rw.Written()))
+	code, desc := semconv.SpanStatusFromHTTPStatusCodeAndSpanKind(rw.Status(), trace.SpanKindServer)
+	if cfg.errorOn4xx && 400 <= rw.Status() && rw.Status() < 500 {
+		code, desc = codes.Error, http.StatusText(rw.Status())
+	}
+	span.SetStatus(code, desc)
+}
 
-func (fn rtFn) RoundTrip(req *http.Request) (*http.Response, error) { return fn(req) }
+var (
+	// ErrInvalidUpstream is reported when the request to the upstream cannot be made, like for a malformed host.
+	ErrInvalidUpstream = errors.New("invalid upstream")
+	// ErrUpstreamUnavailable is reported when the upstream cannot be reached or its response cannot be read.
+	ErrUpstreamUnavailable = errors.New("upstream unavailable")
+)
 
-func (a *App) ServeHTTP(_ http.ResponseWriter, r *http.Request) {
-	_ = a.someSubStackScopeCall(r.Context())
+// upstreamError keeps the cause of an upstream failure, like context.DeadlineExceeded,
+// while it is also one of the sentinel errors above.
+type upstreamError struct {
+	kind error
+	err  error
 }
 
-func (a *App) someSubStackScopeCall(ctx context.Context) error {
-	// make external request with tracing
-	req, _ := http.NewRequest(http.MethodGet, a.host+"/", strings.NewReader("Hello, world!"))
-	req = req.WithContext(ctx)
-	fmt.Println(a.client.Do(req))
+func (e *upstreamError) Error() string        { return e.kind.Error() + ": " + e.err.Error() }
+func (e *upstreamError) Unwrap() error        { return e.err }
+func (e *upstreamError) Is(target error) bool { return target == e.kind }
 
-	// take span from context -> take tracing id from span
+// statusFromError maps the errors of someSubStackScopeCall to the status App replies with.
+func statusFromError(err error) int {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, ErrUpstreamUnavailable):
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// publicError is the text of err that the callers of App may read: the kind of an upstream error,
+// or the status text. The cause names the upstream URLs and addresses, so it is only recorded on the span and logged.
+func publicError(err error, status int) string {
+	var ue *upstreamError
+	if errors.As(err, &ue) {
+		return ue.kind.Error()
+	}
+	return http.StatusText(status)
+}
+
+// upstreamResponse is the response of the upstream, read entirely so its connection is released.
+type upstreamResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// errorResponse is the JSON body App replies with when the upstream call fails.
+// Its error is the one of publicError, and the trace ID leads to the cause recorded on the span.
+type errorResponse struct {
+	Error   string `json:"error"`
+	Status  int    `json:"status"`
+	TraceID string `json:"trace_id,omitempty"`
+}
+
+func (a *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	results, err := a.someSubStackScopeCall(r.Context())
+	if err != nil {
+		a.writeError(r.Context(), w, err)
+		return
+	}
+	if len(results) == 1 {
+		resp := results[0].resp
+		if ct := resp.header.Get("Content-Type"); ct != "" {
+			w.Header().Set("Content-Type", ct)
+		}
+		w.WriteHeader(resp.status)
+		_, _ = w.Write(resp.body)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(newFanOutResponse(results))
+}
+
+// writeError records err on the span of the request, and replies with its status as a JSON error.
+func (a *App) writeError(ctx context.Context, w http.ResponseWriter, err error) {
 	span := trace.SpanFromContext(ctx)
-	ctxFromSpan := span.SpanContext()
-	traceID := ctxFromSpan.TraceID()
-	a.l.Println("trace_id:", traceID.String())
-	return nil
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+
+	status := statusFromError(err)
+	a.l.Error(ctx, "upstream call failed", attribute.String("error", err.Error()), semconv.HTTPStatusCodeKey.Int(status))
+	body := errorResponse{Error: publicError(err, status), Status: status}
+	if sc := span.SpanContext(); sc.HasTraceID() {
+		body.TraceID = sc.TraceID().String()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func (a *App) someSubStackScopeCall(ctx context.Context) ([]upstreamResult, error) {
+	a.l.Info(ctx, "calling upstreams", attribute.Int("upstreams", len(a.upstreams)))
+
+	// make external requests with tracing
+	return a.fanOut(ctx)
 }
 
 // HeaderCarrier adapts http.Header to satisfy the TextMapCarrier interface.
@@ -86,13 +247,11 @@ type HeaderCarrier http.Header
 
 // Get returns the value associated with the passed key.
 func (hc HeaderCarrier) Get(key string) string {
-	fmt.Println("header key:", key)
 	return http.Header(hc).Get(key)
 }
 
 // Set stores the key-value pair.
 func (hc HeaderCarrier) Set(key string, value string) {
-	fmt.Println("header key:", key, "header value:", value)
 	http.Header(hc).Set(key, value)
 }
 
@@ -104,3 +263,23 @@ func (hc HeaderCarrier) Keys() []string {
 	}
 	return keys
 }
+
+// debugCarrier reports every header the propagator reads or writes to the debug hook.
+type debugCarrier struct {
+	ctx     context.Context
+	carrier propagation.TextMapCarrier
+	hook    agstracing.DebugHook
+}
+
+func (dc debugCarrier) Get(key string) string {
+	value := dc.carrier.Get(key)
+	dc.hook.Report(dc.ctx, agstracing.LevelDebug, "header get", attribute.String("key", key), attribute.String("value", value))
+	return value
+}
+
+func (dc debugCarrier) Set(key string, value string) {
+	dc.hook.Report(dc.ctx, agstracing.LevelDebug, "header set", attribute.String("key", key), attribute.String("value", value))
+	dc.carrier.Set(key, value)
+}
+
+func (dc debugCarrier) Keys() []string { return dc.carrier.Keys() }
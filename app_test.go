@@ -5,16 +5,19 @@ import (
 	"context"
 	crand "crypto/rand"
 	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/sdk/resource"
 	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
 	"io"
-	"log"
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -25,6 +28,7 @@ import (
 	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 
 	"github.com/adamluzsi/testcase/assert"
+	"github.com/mikejeuga/OTEL_training/agstracing"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -72,10 +76,11 @@ func NewSubject(tb testing.TB, url string) Subject {
 	tracingSubject := makeTracingPropagation(tb)
 
 	logBuf := &bytes.Buffer{}
-	logger := log.New(logBuf, "", log.LstdFlags)
+	logger := agstracing.NewLogger(agstracing.NewWriterSink(logBuf, agstracing.FormatLogfmt))
 
 	return Subject{
 		Handler:        NewHTTPHandler(url, logger, tracingSubject.TextMapPropagator, tracingSubject.TracerProvider),
+		LoggerBuffer:   logBuf,
 		TracingSubject: tracingSubject,
 	}
 }
@@ -246,3 +251,77 @@ func newResource(tb testing.TB) *resource.Resource {
 	assert.Must(tb).Nil(err)
 	return r
 }
+
+func TestApp_upstreamResponse(t *testing.T) {
+	serve := func(t *testing.T, host string) (*httptest.ResponseRecorder, []traceSDK.ReadOnlySpan) {
+		recorder := tracetest.NewSpanRecorder()
+		tracerProvider := traceSDK.NewTracerProvider(traceSDK.WithSpanProcessor(recorder))
+		handler := NewHTTPHandler(host, nil, propagation.TraceContext{}, tracerProvider)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rr, recorder.Ended()
+	}
+	serverSpan := func(spans []traceSDK.ReadOnlySpan) traceSDK.ReadOnlySpan {
+		for _, span := range spans {
+			if span.SpanKind() == trace.SpanKindServer {
+				return span
+			}
+		}
+		return nil
+	}
+
+	t.Run("upstream status and body are relayed", func(t *testing.T) {
+		srv := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte("created"))
+		})
+		rr, _ := serve(t, srv.URL)
+		assert.Must(t).Equal(http.StatusCreated, rr.Code)
+		assert.Must(t).Equal("text/plain", rr.Header().Get("Content-Type"))
+		assert.Must(t).Equal("created", rr.Body.String())
+	})
+
+	t.Run("unreachable upstream is answered with a JSON error and recorded on the span", func(t *testing.T) {
+		srv := httptest.NewServer(http.NotFoundHandler())
+		srv.Close()
+		rr, spans := serve(t, srv.URL)
+		assert.Must(t).Equal(http.StatusBadGateway, rr.Code)
+		assert.Must(t).Equal("application/json", rr.Header().Get("Content-Type"))
+		var body errorResponse
+		assert.Must(t).Nil(json.Unmarshal(rr.Body.Bytes(), &body))
+		assert.Must(t).Equal(http.StatusBadGateway, body.Status)
+		assert.Must(t).Equal(ErrUpstreamUnavailable.Error(), body.Error)
+		assert.Must(t).NotContain(rr.Body.String(), strings.TrimPrefix(srv.URL, "http://"))
+
+		span := serverSpan(spans)
+		assert.Must(t).NotNil(span)
+		assert.Must(t).Equal(span.SpanContext().TraceID().String(), body.TraceID)
+		assert.Must(t).Equal(codes.Error, span.Status().Code)
+		assert.Must(t).Equal(1, len(span.Events()))
+		assert.Must(t).Equal(semconv.ExceptionEventName, span.Events()[0].Name)
+	})
+
+	t.Run("invalid upstream is an internal error", func(t *testing.T) {
+		rr, spans := serve(t, "http://[::1")
+		assert.Must(t).Equal(http.StatusInternalServerError, rr.Code)
+		var body errorResponse
+		assert.Must(t).Nil(json.Unmarshal(rr.Body.Bytes(), &body))
+		assert.Must(t).Equal(ErrInvalidUpstream.Error(), body.Error)
+		assert.Must(t).NotContain(rr.Body.String(), "[::1")
+		events := serverSpan(spans).Events()
+		assert.Must(t).Equal(1, len(events))
+		assert.Must(t).Contain(attributeMap(events[0].Attributes)[semconv.ExceptionMessageKey].AsString(), "[::1")
+	})
+}
+
+func TestStatusFromError(t *testing.T) {
+	for err, expected := range map[error]int{
+		&upstreamError{kind: ErrInvalidUpstream, err: errors.New("boom")}:                                  http.StatusInternalServerError,
+		&upstreamError{kind: ErrUpstreamUnavailable, err: errors.New("connection refused")}:                http.StatusBadGateway,
+		&upstreamError{kind: ErrUpstreamUnavailable, err: fmt.Errorf("get: %w", context.DeadlineExceeded)}: http.StatusGatewayTimeout,
+		errors.New("unknown"): http.StatusInternalServerError,
+	} {
+		assert.Must(t).Equal(expected, statusFromError(err), err.Error())
+	}
+}
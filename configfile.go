@@ -0,0 +1,413 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	traceSDK "go.opentelemetry.io/otel/sdk/trace"
+	"gopkg.in/yaml.v3"
+)
+
+// TracingConfig describes the tracing pipeline in a YAML or JSON file, like:
+//
+//	resource:
+//	  attributes:
+//	    service.name: ags
+//	sampler:
+//	  type: parentbased
+//	  root: {type: traceidratio, ratio: 0.1}
+//	exporters:
+//	  collector: {type: otlp, endpoint: "collector:4318", insecure: true}
+//	  debug: {type: console}
+//	processors:
+//	  - {type: batch, exporter: collector}
+//	  - {type: simple, exporter: debug}
+//	propagators: [tracecontext, baggage]
+type TracingConfig struct {
+	Resource    ResourceConfig            `json:"resource" yaml:"resource"`
+	Sampler     *SamplerConfig            `json:"sampler,omitempty" yaml:"sampler,omitempty"`
+	Exporters   map[string]ExporterConfig `json:"exporters,omitempty" yaml:"exporters,omitempty"`
+	Processors  []ProcessorConfig         `json:"processors,omitempty" yaml:"processors,omitempty"`
+	Propagators []string                  `json:"propagators,omitempty" yaml:"propagators,omitempty"`
+}
+
+// ResourceConfig describes the resource of the spans.
+type ResourceConfig struct {
+	Attributes map[string]string `json:"attributes,omitempty" yaml:"attributes,omitempty"`
+}
+
+// SamplerConfig describes a sampler. The parentbased sampler delegates to the other samplers,
+// depending on the parent of the span. Its root sampler is always_on by default,
+// and the other ones follow the sampled flag of the parent.
+type SamplerConfig struct {
+	// Type is always_on, always_off, traceidratio or parentbased.
+	Type string `json:"type" yaml:"type"`
+	// Ratio is the ratio of traceidratio.
+	Ratio                  *float64       `json:"ratio,omitempty" yaml:"ratio,omitempty"`
+	Root                   *SamplerConfig `json:"root,omitempty" yaml:"root,omitempty"`
+	RemoteParentSampled    *SamplerConfig `json:"remote_parent_sampled,omitempty" yaml:"remote_parent_sampled,omitempty"`
+	RemoteParentNotSampled *SamplerConfig `json:"remote_parent_not_sampled,omitempty" yaml:"remote_parent_not_sampled,omitempty"`
+	LocalParentSampled     *SamplerConfig `json:"local_parent_sampled,omitempty" yaml:"local_parent_sampled,omitempty"`
+	LocalParentNotSampled  *SamplerConfig `json:"local_parent_not_sampled,omitempty" yaml:"local_parent_not_sampled,omitempty"`
+}
+
+// ExporterConfig describes a span exporter.
+type ExporterConfig struct {
+	// Type is otlp or console.
+	Type string `json:"type" yaml:"type"`
+	// Endpoint is the host and port of the otlp collector, like "collector:4318".
+	Endpoint string            `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+	Insecure bool              `json:"insecure,omitempty" yaml:"insecure,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Timeout  Duration          `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+// ProcessorConfig describes a span processor, and the exporter it sends the spans to.
+type ProcessorConfig struct {
+	// Type is batch or simple.
+	Type     string `json:"type" yaml:"type"`
+	Exporter string `json:"exporter" yaml:"exporter"`
+	// The batch settings default to the ones of the SDK.
+	ScheduleDelay      Duration `json:"schedule_delay,omitempty" yaml:"schedule_delay,omitempty"`
+	ExportTimeout      Duration `json:"export_timeout,omitempty" yaml:"export_timeout,omitempty"`
+	MaxQueueSize       int      `json:"max_queue_size,omitempty" yaml:"max_queue_size,omitempty"`
+	MaxExportBatchSize int      `json:"max_export_batch_size,omitempty" yaml:"max_export_batch_size,omitempty"`
+}
+
+// Duration is a time.Duration written like "5s" in the configuration files.
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) { return []byte(time.Duration(d).String()), nil }
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// ConfigError lists every problem of a TracingConfig, with the path of the invalid field.
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return "invalid tracing config: " + strings.Join(e.Problems, "; ")
+}
+
+// LoadTracingConfig reads the configuration file at path, as JSON when its extension is .json, and as YAML otherwise.
+// Unknown fields are errors, and the defaults are applied.
+func LoadTracingConfig(path string) (TracingConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return TracingConfig{}, err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return ParseTracingConfig(data, "json")
+	}
+	return ParseTracingConfig(data, "yaml")
+}
+
+// ParseTracingConfig parses the configuration in the format, json or yaml, validates it and applies the defaults.
+func ParseTracingConfig(data []byte, format string) (TracingConfig, error) {
+	var cfg TracingConfig
+	switch format {
+	case "json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&cfg); err != nil {
+			return TracingConfig{}, fmt.Errorf("invalid tracing config: %w", err)
+		}
+	case "yaml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&cfg); err != nil && err != io.EOF {
+			return TracingConfig{}, fmt.Errorf("invalid tracing config: %w", err)
+		}
+	default:
+		return TracingConfig{}, fmt.Errorf("unknown tracing config format %q", format)
+	}
+	cfg.applyDefaults()
+	if err := cfg.Validate(); err != nil {
+		return TracingConfig{}, err
+	}
+	return cfg, nil
+}
+
+// applyDefaults fills what the file left out, so the effective configuration is explicit:
+// a parent based always_on sampler, the tracecontext and baggage propagators,
+// an otlp exporter when there is none, and a batch processor for every exporter when there is no processor.
+func (cfg *TracingConfig) applyDefaults() {
+	if cfg.Sampler == nil {
+		cfg.Sampler = &SamplerConfig{Type: "parentbased"}
+	}
+	cfg.Sampler.applyDefaults()
+	if cfg.Propagators == nil {
+		cfg.Propagators = []string{"tracecontext", "baggage"}
+	}
+	if len(cfg.Exporters) == 0 {
+		cfg.Exporters = map[string]ExporterConfig{"otlp": {Type: "otlp"}}
+	}
+	if len(cfg.Processors) == 0 {
+		for _, name := range sortedKeys(cfg.Exporters) {
+			cfg.Processors = append(cfg.Processors, ProcessorConfig{Type: "batch", Exporter: name})
+		}
+	}
+	for i := range cfg.Processors {
+		p := &cfg.Processors[i]
+		if p.Type != "batch" {
+			continue
+		}
+		if p.ScheduleDelay == 0 {
+			p.ScheduleDelay = Duration(traceSDK.DefaultScheduleDelay * time.Millisecond)
+		}
+		if p.ExportTimeout == 0 {
+			p.ExportTimeout = Duration(traceSDK.DefaultExportTimeout * time.Millisecond)
+		}
+		if p.MaxQueueSize == 0 {
+			p.MaxQueueSize = traceSDK.DefaultMaxQueueSize
+		}
+		if p.MaxExportBatchSize == 0 {
+			p.MaxExportBatchSize = traceSDK.DefaultMaxExportBatchSize
+		}
+	}
+}
+
+func (s *SamplerConfig) applyDefaults() {
+	if s.Type == "traceidratio" && s.Ratio == nil {
+		one := 1.0
+		s.Ratio = &one
+	}
+	if s.Type != "parentbased" {
+		return
+	}
+	if s.Root == nil {
+		s.Root = &SamplerConfig{Type: "always_on"}
+	}
+	for _, child := range []*SamplerConfig{s.Root, s.RemoteParentSampled, s.RemoteParentNotSampled, s.LocalParentSampled, s.LocalParentNotSampled} {
+		if child != nil {
+			child.applyDefaults()
+		}
+	}
+}
+
+// Validate reports every problem of the configuration at once, as a *ConfigError.
+func (cfg TracingConfig) Validate() error {
+	var problems []string
+	problemf := func(format string, args ...interface{}) { problems = append(problems, fmt.Sprintf(format, args...)) }
+
+	if cfg.Sampler != nil {
+		cfg.Sampler.validate("sampler", problemf)
+	}
+	for _, name := range sortedKeys(cfg.Exporters) {
+		exp := cfg.Exporters[name]
+		switch exp.Type {
+		case "otlp", "console":
+		default:
+			problemf("exporters.%s.type: unknown exporter type %q", name, exp.Type)
+		}
+		if exp.Timeout < 0 {
+			problemf("exporters.%s.timeout: must not be negative", name)
+		}
+	}
+	for i, p := range cfg.Processors {
+		switch p.Type {
+		case "batch", "simple":
+		default:
+			problemf("processors[%d].type: unknown processor type %q", i, p.Type)
+		}
+		if _, ok := cfg.Exporters[p.Exporter]; !ok {
+			problemf("processors[%d].exporter: unknown exporter %q", i, p.Exporter)
+		}
+		if p.ScheduleDelay < 0 || p.ExportTimeout < 0 || p.MaxQueueSize < 0 || p.MaxExportBatchSize < 0 {
+			problemf("processors[%d]: batch settings must not be negative", i)
+		}
+		if p.MaxExportBatchSize > p.MaxQueueSize && p.MaxQueueSize > 0 {
+			problemf("processors[%d].max_export_batch_size: must not exceed max_queue_size", i)
+		}
+	}
+	for i, name := range cfg.Propagators {
+		if _, ok := propagatorsByName[name]; !ok && name != "none" {
+			problemf("propagators[%d]: unknown propagator %q", i, name)
+		}
+	}
+	if len(problems) > 0 {
+		return &ConfigError{Problems: problems}
+	}
+	return nil
+}
+
+func (s *SamplerConfig) validate(path string, problemf func(format string, args ...interface{})) {
+	switch s.Type {
+	case "always_on", "always_off":
+	case "traceidratio":
+		if s.Ratio == nil || *s.Ratio < 0 || 1 < *s.Ratio {
+			problemf("%s.ratio: must be between 0 and 1", path)
+		}
+	case "parentbased":
+		for _, c := range []struct {
+			name  string
+			child *SamplerConfig
+		}{
+			{"root", s.Root},
+			{"remote_parent_sampled", s.RemoteParentSampled},
+			{"remote_parent_not_sampled", s.RemoteParentNotSampled},
+			{"local_parent_sampled", s.LocalParentSampled},
+			{"local_parent_not_sampled", s.LocalParentNotSampled},
+		} {
+			if c.child == nil {
+				continue
+			}
+			if c.child.Type == "parentbased" {
+				problemf("%s.%s.type: parentbased samplers cannot be nested", path, c.name)
+				continue
+			}
+			c.child.validate(path+"."+c.name, problemf)
+		}
+	default:
+		problemf("%s.type: unknown sampler type %q", path, s.Type)
+	}
+}
+
+// NewTracingFromConfig builds the tracing described by a configuration, like the one of LoadTracingConfig.
+func NewTracingFromConfig(ctx context.Context, cfg TracingConfig) (Tracing, error) {
+	cfg.applyDefaults()
+	if err := cfg.Validate(); err != nil {
+		return Tracing{}, err
+	}
+
+	attrs := make([]attribute.KeyValue, 0, len(cfg.Resource.Attributes))
+	for _, k := range sortedKeys(cfg.Resource.Attributes) {
+		attrs = append(attrs, attribute.String(k, cfg.Resource.Attributes[k]))
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attrs...))
+	if err != nil {
+		return Tracing{}, err
+	}
+
+	exporters := make(map[string]traceSDK.SpanExporter, len(cfg.Exporters))
+	for name, exp := range cfg.Exporters {
+		exporter, err := exp.newExporter(ctx)
+		if err != nil {
+			return Tracing{}, fmt.Errorf("exporters.%s: %w", name, err)
+		}
+		exporters[name] = exporter
+	}
+	opts := []traceSDK.TracerProviderOption{traceSDK.WithResource(res), traceSDK.WithSampler(cfg.Sampler.newSampler())}
+	for _, p := range cfg.Processors {
+		opts = append(opts, traceSDK.WithSpanProcessor(p.newProcessor(exporters[p.Exporter])))
+	}
+
+	propagator, err := newPropagator(strings.Join(cfg.Propagators, ","))
+	if err != nil {
+		return Tracing{}, err
+	}
+	opts = append(opts, idGeneratorOptions(strings.Join(cfg.Propagators, ","))...)
+	return Tracing{TracerProvider: traceSDK.NewTracerProvider(opts...), Propagator: propagator}, nil
+}
+
+func (s *SamplerConfig) newSampler() traceSDK.Sampler {
+	switch s.Type {
+	case "always_off":
+		return traceSDK.NeverSample()
+	case "traceidratio":
+		return traceSDK.TraceIDRatioBased(*s.Ratio)
+	case "parentbased":
+		var opts []traceSDK.ParentBasedSamplerOption
+		if s.RemoteParentSampled != nil {
+			opts = append(opts, traceSDK.WithRemoteParentSampled(s.RemoteParentSampled.newSampler()))
+		}
+		if s.RemoteParentNotSampled != nil {
+			opts = append(opts, traceSDK.WithRemoteParentNotSampled(s.RemoteParentNotSampled.newSampler()))
+		}
+		if s.LocalParentSampled != nil {
+			opts = append(opts, traceSDK.WithLocalParentSampled(s.LocalParentSampled.newSampler()))
+		}
+		if s.LocalParentNotSampled != nil {
+			opts = append(opts, traceSDK.WithLocalParentNotSampled(s.LocalParentNotSampled.newSampler()))
+		}
+		return traceSDK.ParentBased(s.Root.newSampler(), opts...)
+	default:
+		return traceSDK.AlwaysSample()
+	}
+}
+
+func (exp ExporterConfig) newExporter(ctx context.Context) (traceSDK.SpanExporter, error) {
+	if exp.Type == "console" {
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	}
+	var opts []otlptracehttp.Option
+	if exp.Endpoint != "" {
+		opts = append(opts, otlptracehttp.WithEndpoint(exp.Endpoint))
+	}
+	if exp.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	if len(exp.Headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(exp.Headers))
+	}
+	if exp.Timeout > 0 {
+		opts = append(opts, otlptracehttp.WithTimeout(time.Duration(exp.Timeout)))
+	}
+	return otlptracehttp.New(ctx, opts...)
+}
+
+func (p ProcessorConfig) newProcessor(exporter traceSDK.SpanExporter) traceSDK.SpanProcessor {
+	if p.Type == "simple" {
+		return traceSDK.NewSimpleSpanProcessor(exporter)
+	}
+	return traceSDK.NewBatchSpanProcessor(exporter,
+		traceSDK.WithBatchTimeout(time.Duration(p.ScheduleDelay)),
+		traceSDK.WithExportTimeout(time.Duration(p.ExportTimeout)),
+		traceSDK.WithMaxQueueSize(p.MaxQueueSize),
+		traceSDK.WithMaxExportBatchSize(p.MaxExportBatchSize),
+	)
+}
+
+// PrintEffectiveConfig writes the configuration with its defaults as YAML, to attach to support tickets.
+// The exporter header values are redacted, as they often hold credentials.
+func PrintEffectiveConfig(w io.Writer, cfg TracingConfig) error {
+	cfg.applyDefaults()
+	exporters := make(map[string]ExporterConfig, len(cfg.Exporters))
+	for name, exp := range cfg.Exporters {
+		if len(exp.Headers) > 0 {
+			headers := make(map[string]string, len(exp.Headers))
+			for k := range exp.Headers {
+				headers[k] = "REDACTED"
+			}
+			exp.Headers = headers
+		}
+		exporters[name] = exp
+	}
+	cfg.Exporters = exporters
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(cfg); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/adamluzsi/testcase/assert"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracingConfigYAML = `
+resource:
+  attributes:
+    service.name: ags
+sampler:
+  type: parentbased
+  root: {type: traceidratio, ratio: 0}
+exporters:
+  collector:
+    type: otlp
+    endpoint: collector:4318
+    insecure: true
+    headers: {authorization: Bearer secret}
+processors:
+  - {type: batch, exporter: collector, schedule_delay: 1s}
+propagators: [tracecontext]
+`
+
+func TestParseTracingConfig(t *testing.T) {
+	t.Run("YAML with defaults", func(t *testing.T) {
+		cfg, err := ParseTracingConfig([]byte(tracingConfigYAML), "yaml")
+		assert.Must(t).Nil(err)
+		assert.Must(t).Equal("ags", cfg.Resource.Attributes["service.name"])
+		assert.Must(t).Equal(0.0, *cfg.Sampler.Root.Ratio)
+		assert.Must(t).Equal(Duration(time.Second), cfg.Processors[0].ScheduleDelay)
+		assert.Must(t).Equal(Duration(30*time.Second), cfg.Processors[0].ExportTimeout)
+		assert.Must(t).Equal(2048, cfg.Processors[0].MaxQueueSize)
+		assert.Must(t).Equal([]string{"tracecontext"}, cfg.Propagators)
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		cfg, err := ParseTracingConfig([]byte(`{"exporters": {"debug": {"type": "console"}}, "sampler": {"type": "always_off"}}`), "json")
+		assert.Must(t).Nil(err)
+		assert.Must(t).Equal([]ProcessorConfig{{
+			Type:               "batch",
+			Exporter:           "debug",
+			ScheduleDelay:      Duration(5 * time.Second),
+			ExportTimeout:      Duration(30 * time.Second),
+			MaxQueueSize:       2048,
+			MaxExportBatchSize: 512,
+		}}, cfg.Processors)
+		assert.Must(t).Equal([]string{"tracecontext", "baggage"}, cfg.Propagators)
+	})
+
+	t.Run("unknown fields are rejected", func(t *testing.T) {
+		_, err := ParseTracingConfig([]byte("sampler: {type: always_on, rate: 1}"), "yaml")
+		assert.Must(t).NotNil(err)
+		_, err = ParseTracingConfig([]byte(`{"sampler": {"type": "always_on", "rate": 1}}`), "json")
+		assert.Must(t).NotNil(err)
+	})
+
+	t.Run("every problem is reported", func(t *testing.T) {
+		_, err := ParseTracingConfig([]byte(`
+sampler:
+  type: parentbased
+  root: {type: traceidratio, ratio: 2}
+  remote_parent_sampled: {type: parentbased}
+exporters:
+  collector: {type: zipkin}
+processors:
+  - {type: batch, exporter: missing, max_queue_size: 10, max_export_batch_size: 20}
+  - {type: eventual, exporter: collector}
+propagators: [tracecontext, carrier-pigeon]
+`), "yaml")
+		var cfgErr *ConfigError
+		assert.Must(t).True(errors.As(err, &cfgErr))
+		assert.Must(t).Equal([]string{
+			"sampler.root.ratio: must be between 0 and 1",
+			"sampler.remote_parent_sampled.type: parentbased samplers cannot be nested",
+			`exporters.collector.type: unknown exporter type "zipkin"`,
+			`processors[0].exporter: unknown exporter "missing"`,
+			"processors[0].max_export_batch_size: must not exceed max_queue_size",
+			`processors[1].type: unknown processor type "eventual"`,
+			`propagators[1]: unknown propagator "carrier-pigeon"`,
+		}, cfgErr.Problems)
+		assert.Must(t).Equal("invalid tracing config: "+
+			"sampler.root.ratio: must be between 0 and 1; "+
+			"sampler.remote_parent_sampled.type: parentbased samplers cannot be nested; "+
+			`exporters.collector.type: unknown exporter type "zipkin"; `+
+			`processors[0].exporter: unknown exporter "missing"; `+
+			"processors[0].max_export_batch_size: must not exceed max_queue_size; "+
+			`processors[1].type: unknown processor type "eventual"; `+
+			`propagators[1]: unknown propagator "carrier-pigeon"`, err.Error())
+	})
+}
+
+func TestLoadTracingConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tracing.yaml")
+	assert.Must(t).Nil(os.WriteFile(path, []byte(tracingConfigYAML), 0o600))
+	cfg, err := LoadTracingConfig(path)
+	assert.Must(t).Nil(err)
+
+	tracing, err := NewTracingFromConfig(context.Background(), cfg)
+	assert.Must(t).Nil(err)
+	t.Cleanup(func() { _ = tracing.TracerProvider.Shutdown(context.Background()) })
+	assert.Must(t).ContainExactly([]string{"traceparent", "tracestate"}, tracing.Propagator.Fields())
+
+	_, root := tracing.TracerProvider.Tracer("test").Start(context.Background(), "root")
+	assert.Must(t).False(root.SpanContext().IsSampled(), "the root sampler has a ratio of 0")
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x01},
+		SpanID:     trace.SpanID{0x01},
+		TraceFlags: trace.FlagsSampled,
+	}))
+	_, child := tracing.TracerProvider.Tracer("test").Start(ctx, "child")
+	assert.Must(t).True(child.SpanContext().IsSampled(), "sampled parents are followed")
+
+	_, err = LoadTracingConfig(filepath.Join(dir, "missing.json"))
+	assert.Must(t).NotNil(err)
+}
+
+func TestPrintEffectiveConfig(t *testing.T) {
+	cfg, err := ParseTracingConfig([]byte(tracingConfigYAML), "yaml")
+	assert.Must(t).Nil(err)
+	buf := &bytes.Buffer{}
+	assert.Must(t).Nil(PrintEffectiveConfig(buf, cfg))
+	assert.Must(t).Contain(buf.String(), "authorization: REDACTED")
+	assert.Must(t).NotContain(buf.String(), "secret")
+	assert.Must(t).Contain(buf.String(), "export_timeout: 30s")
+	assert.Must(t).Contain(buf.String(), "max_queue_size: 2048")
+	assert.Must(t).Equal("Bearer secret", cfg.Exporters["collector"].Headers["authorization"], "the config itself is not redacted")
+
+	printed, err := ParseTracingConfig(buf.Bytes(), "yaml")
+	assert.Must(t).Nil(err, "the effective config can be loaded again")
+	assert.Must(t).Equal(cfg.Processors, printed.Processors)
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mikejeuga/OTEL_training/agstracing/propagators"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	traceSDK "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+)
+
+// Tracing is the TracerProvider and the TextMapPropagator to give to NewHTTPHandler.
+type Tracing struct {
+	TracerProvider *traceSDK.TracerProvider
+	Propagator     propagation.TextMapPropagator
+}
+
+// EnvError lists every invalid OTEL_* environment variable, so they can be fixed at once.
+type EnvError struct {
+	Problems []EnvProblem
+}
+
+// EnvProblem is an invalid environment variable.
+type EnvProblem struct {
+	Key   string
+	Value string
+	Err   error
+}
+
+func (p EnvProblem) Error() string { return fmt.Sprintf("%s=%q: %v", p.Key, p.Value, p.Err) }
+
+func (e *EnvError) Error() string {
+	msgs := make([]string, 0, len(e.Problems))
+	for _, p := range e.Problems {
+		msgs = append(msgs, p.Error())
+	}
+	return "invalid environment: " + strings.Join(msgs, "; ")
+}
+
+// NewTracingFromEnv builds the tracing from the standard OpenTelemetry SDK environment variables:
+// OTEL_SERVICE_NAME, OTEL_RESOURCE_ATTRIBUTES, OTEL_TRACES_EXPORTER (otlp, console or none),
+// OTEL_PROPAGATORS, OTEL_TRACES_SAMPLER, OTEL_TRACES_SAMPLER_ARG and OTEL_BSP_*.
+// The otlp exporter also reads the OTEL_EXPORTER_OTLP_* variables.
+// The propagators are tracecontext, baggage, b3, b3multi, jaeger and xray, which also makes X-Ray trace IDs.
+//
+// The variables are read with getenv, like os.Getenv. When some of them are invalid, the error is an *EnvError.
+func NewTracingFromEnv(ctx context.Context, getenv func(string) string) (Tracing, error) {
+	env := envReader{getenv: getenv}
+	res := env.resource()
+	sampler := env.sampler()
+	bsp := env.batchSpanProcessorOptions()
+	propagator := env.propagator()
+	exporterName := env.exporterName()
+	if len(env.problems) > 0 {
+		return Tracing{}, &EnvError{Problems: env.problems}
+	}
+
+	exporter, err := newSpanExporter(ctx, exporterName, os.Stdout)
+	if err != nil {
+		return Tracing{}, err
+	}
+	opts := []traceSDK.TracerProviderOption{
+		traceSDK.WithResource(res),
+		traceSDK.WithSampler(sampler),
+		traceSDK.WithBatcher(exporter, bsp...),
+	}
+	opts = append(opts, idGeneratorOptions(env.get("OTEL_PROPAGATORS", ""))...)
+	return Tracing{TracerProvider: traceSDK.NewTracerProvider(opts...), Propagator: propagator}, nil
+}
+
+// envReader reads the environment variables, and collects their problems instead of stopping at the first one.
+type envReader struct {
+	getenv   func(string) string
+	problems []EnvProblem
+}
+
+func (r *envReader) get(key, fallback string) string {
+	if v := strings.TrimSpace(r.getenv(key)); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func (r *envReader) problem(key, value string, err error) {
+	r.problems = append(r.problems, EnvProblem{Key: key, Value: value, Err: err})
+}
+
+func (r *envReader) resource() *resource.Resource {
+	var attrs []attribute.KeyValue
+	if raw := r.get("OTEL_RESOURCE_ATTRIBUTES", ""); raw != "" {
+		for _, pair := range strings.Split(raw, ",") {
+			k, v, ok := strings.Cut(pair, "=")
+			k = strings.TrimSpace(k)
+			if !ok || k == "" {
+				r.problem("OTEL_RESOURCE_ATTRIBUTES", raw, fmt.Errorf("%q is not a key=value pair", pair))
+				continue
+			}
+			value, err := url.QueryUnescape(strings.TrimSpace(v))
+			if err != nil {
+				r.problem("OTEL_RESOURCE_ATTRIBUTES", raw, fmt.Errorf("value of %q: %w", k, err))
+				continue
+			}
+			attrs = append(attrs, attribute.String(k, value))
+		}
+	}
+	if serviceName := r.get("OTEL_SERVICE_NAME", ""); serviceName != "" {
+		attrs = append(attrs, semconv.ServiceNameKey.String(serviceName))
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attrs...))
+	if err != nil {
+		r.problem("OTEL_RESOURCE_ATTRIBUTES", r.getenv("OTEL_RESOURCE_ATTRIBUTES"), err)
+	}
+	return res
+}
+
+func (r *envReader) sampler() traceSDK.Sampler {
+	name := r.get("OTEL_TRACES_SAMPLER", "parentbased_always_on")
+	ratio := func() float64 {
+		raw := r.get("OTEL_TRACES_SAMPLER_ARG", "1.0")
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil || v < 0 || 1 < v {
+			r.problem("OTEL_TRACES_SAMPLER_ARG", raw, fmt.Errorf("must be a ratio between 0 and 1"))
+			return 1
+		}
+		return v
+	}
+	switch name {
+	case "always_on":
+		return traceSDK.AlwaysSample()
+	case "always_off":
+		return traceSDK.NeverSample()
+	case "traceidratio":
+		return traceSDK.TraceIDRatioBased(ratio())
+	case "parentbased_always_on":
+		return traceSDK.ParentBased(traceSDK.AlwaysSample())
+	case "parentbased_always_off":
+		return traceSDK.ParentBased(traceSDK.NeverSample())
+	case "parentbased_traceidratio":
+		return traceSDK.ParentBased(traceSDK.TraceIDRatioBased(ratio()))
+	default:
+		r.problem("OTEL_TRACES_SAMPLER", name, fmt.Errorf("unknown sampler"))
+		return traceSDK.ParentBased(traceSDK.AlwaysSample())
+	}
+}
+
+func (r *envReader) batchSpanProcessorOptions() []traceSDK.BatchSpanProcessorOption {
+	var opts []traceSDK.BatchSpanProcessorOption
+	positive := func(key string) (int, bool) {
+		raw := r.get(key, "")
+		if raw == "" {
+			return 0, false
+		}
+		v, err := strconv.Atoi(raw)
+		if err != nil || v <= 0 {
+			r.problem(key, raw, fmt.Errorf("must be a positive integer"))
+			return 0, false
+		}
+		return v, true
+	}
+	if v, ok := positive("OTEL_BSP_SCHEDULE_DELAY"); ok {
+		opts = append(opts, traceSDK.WithBatchTimeout(time.Duration(v)*time.Millisecond))
+	}
+	if v, ok := positive("OTEL_BSP_EXPORT_TIMEOUT"); ok {
+		opts = append(opts, traceSDK.WithExportTimeout(time.Duration(v)*time.Millisecond))
+	}
+	queueSize, hasQueueSize := positive("OTEL_BSP_MAX_QUEUE_SIZE")
+	if hasQueueSize {
+		opts = append(opts, traceSDK.WithMaxQueueSize(queueSize))
+	}
+	if v, ok := positive("OTEL_BSP_MAX_EXPORT_BATCH_SIZE"); ok {
+		if hasQueueSize && v > queueSize {
+			r.problem("OTEL_BSP_MAX_EXPORT_BATCH_SIZE", strconv.Itoa(v), fmt.Errorf("must not exceed OTEL_BSP_MAX_QUEUE_SIZE"))
+		}
+		opts = append(opts, traceSDK.WithMaxExportBatchSize(v))
+	}
+	return opts
+}
+
+func (r *envReader) exporterName() string {
+	name := r.get("OTEL_TRACES_EXPORTER", "otlp")
+	switch name {
+	case "otlp", "console", "none":
+	default:
+		r.problem("OTEL_TRACES_EXPORTER", name, fmt.Errorf("unknown exporter"))
+	}
+	return name
+}
+
+func (r *envReader) propagator() propagation.TextMapPropagator {
+	raw := r.get("OTEL_PROPAGATORS", "tracecontext,baggage")
+	p, err := newPropagator(raw)
+	if err != nil {
+		r.problem("OTEL_PROPAGATORS", raw, err)
+		return propagation.NewCompositeTextMapPropagator()
+	}
+	return p
+}
+
+// newSpanExporter makes the exporter named like in OTEL_TRACES_EXPORTER.
+// The otlp exporter is configured with the OTEL_EXPORTER_OTLP_* environment variables.
+func newSpanExporter(ctx context.Context, name string, output io.Writer) (traceSDK.SpanExporter, error) {
+	switch name {
+	case "console":
+		return stdouttrace.New(stdouttrace.WithWriter(output))
+	case "otlp":
+		return otlptracehttp.New(ctx)
+	case "none":
+		return discardExporter{}, nil
+	default:
+		return nil, fmt.Errorf("unknown exporter %q", name)
+	}
+}
+
+// discardExporter drops the spans. It is used for the "none" exporter,
+// as a TracerProvider without span processor fails to flush and to shut down.
+type discardExporter struct{}
+
+func (discardExporter) ExportSpans(context.Context, []traceSDK.ReadOnlySpan) error { return nil }
+
+func (discardExporter) Shutdown(context.Context) error { return nil }
+
+// propagatorsByName are the propagators that can be named in OTEL_PROPAGATORS.
+var propagatorsByName = map[string]propagation.TextMapPropagator{
+	"tracecontext": propagation.TraceContext{},
+	"baggage":      propagation.Baggage{},
+	"b3":           propagators.B3{InjectEncoding: propagators.B3SingleHeader},
+	"b3multi":      propagators.B3{InjectEncoding: propagators.B3MultipleHeader},
+	"jaeger":       propagators.Jaeger{},
+	"xray":         propagators.XRay{},
+}
+
+// idGeneratorOptions makes the trace IDs time-prefixed when the comma separated propagators include xray,
+// as X-Ray refuses the traces with random IDs.
+func idGeneratorOptions(names string) []traceSDK.TracerProviderOption {
+	for _, n := range strings.Split(names, ",") {
+		if strings.TrimSpace(n) == "xray" {
+			return []traceSDK.TracerProviderOption{traceSDK.WithIDGenerator(propagators.NewXRayIDGenerator())}
+		}
+	}
+	return nil
+}
+
+// newPropagator composes the comma separated propagators, in order.
+// "none" means no propagator, as in OTEL_PROPAGATORS.
+func newPropagator(names string) (propagation.TextMapPropagator, error) {
+	var (
+		ps      []propagation.TextMapPropagator
+		unknown []string
+	)
+	for _, n := range strings.Split(names, ",") {
+		n = strings.TrimSpace(n)
+		if n == "" || n == "none" {
+			continue
+		}
+		p, ok := propagatorsByName[n]
+		if !ok {
+			unknown = append(unknown, strconv.Quote(n))
+			continue
+		}
+		ps = append(ps, p)
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown propagators %s", strings.Join(unknown, ", "))
+	}
+	return propagation.NewCompositeTextMapPropagator(ps...), nil
+}
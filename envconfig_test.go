@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/adamluzsi/testcase/assert"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestNewTracingFromEnv(t *testing.T) {
+	newTracing := func(t *testing.T, env map[string]string) (Tracing, error) {
+		tracing, err := NewTracingFromEnv(context.Background(), func(key string) string { return env[key] })
+		if err == nil {
+			t.Cleanup(func() { _ = tracing.TracerProvider.Shutdown(context.Background()) })
+		}
+		return tracing, err
+	}
+
+	t.Run("resource, sampler and propagators are read from the environment", func(t *testing.T) {
+		tracing, err := newTracing(t, map[string]string{
+			"OTEL_SERVICE_NAME":        "ags",
+			"OTEL_RESOURCE_ATTRIBUTES": "deployment.environment=prod,team=a%20team",
+			"OTEL_TRACES_EXPORTER":     "none",
+			"OTEL_TRACES_SAMPLER":      "always_off",
+			"OTEL_PROPAGATORS":         "baggage",
+			"OTEL_BSP_MAX_QUEUE_SIZE":  "100",
+		})
+		assert.Must(t).Nil(err)
+		assert.Must(t).Equal([]string{"baggage"}, tracing.Propagator.Fields())
+
+		_, span := tracing.TracerProvider.Tracer("test").Start(context.Background(), "span")
+		assert.Must(t).False(span.SpanContext().IsSampled())
+		span.End()
+	})
+
+	t.Run("resource attributes are set", func(t *testing.T) {
+		env := envReader{getenv: func(key string) string {
+			return map[string]string{
+				"OTEL_SERVICE_NAME":        "ags",
+				"OTEL_RESOURCE_ATTRIBUTES": "service.name=ignored,team=a%20team",
+			}[key]
+		}}
+		res := env.resource()
+		assert.Must(t).Equal(0, len(env.problems))
+		attrs := attributeMap(res.Attributes())
+		assert.Must(t).Equal("ags", attrs[semconv.ServiceNameKey].AsString())
+		assert.Must(t).Equal("a team", attrs[attribute.Key("team")].AsString())
+	})
+
+	t.Run("parent based sampling is the default", func(t *testing.T) {
+		tracing, err := newTracing(t, map[string]string{"OTEL_TRACES_EXPORTER": "none"})
+		assert.Must(t).Nil(err)
+		ctx := trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID: trace.TraceID{0x01},
+			SpanID:  trace.SpanID{0x01},
+		}))
+		_, span := tracing.TracerProvider.Tracer("test").Start(ctx, "span")
+		assert.Must(t).False(span.SpanContext().IsSampled())
+		span.End()
+		assert.Must(t).ContainExactly([]string{"traceparent", "tracestate", "baggage"}, tracing.Propagator.Fields())
+	})
+
+	t.Run("b3 propagators can be named", func(t *testing.T) {
+		tracing, err := newTracing(t, map[string]string{"OTEL_TRACES_EXPORTER": "none", "OTEL_PROPAGATORS": "b3"})
+		assert.Must(t).Nil(err)
+		assert.Must(t).Equal([]string{"b3"}, tracing.Propagator.Fields())
+
+		tracing, err = newTracing(t, map[string]string{"OTEL_TRACES_EXPORTER": "none", "OTEL_PROPAGATORS": "b3multi"})
+		assert.Must(t).Nil(err)
+		assert.Must(t).ContainExactly([]string{"x-b3-traceid", "x-b3-spanid", "x-b3-sampled", "x-b3-flags"}, tracing.Propagator.Fields())
+	})
+
+	t.Run("xray propagator makes time-prefixed trace IDs", func(t *testing.T) {
+		tracing, err := newTracing(t, map[string]string{"OTEL_TRACES_EXPORTER": "none", "OTEL_PROPAGATORS": "tracecontext,xray"})
+		assert.Must(t).Nil(err)
+		_, span := tracing.TracerProvider.Tracer("test").Start(context.Background(), "span")
+		span.End()
+		tid := span.SpanContext().TraceID()
+		started := time.Unix(int64(binary.BigEndian.Uint32(tid[:4])), 0)
+		assert.Must(t).True(time.Since(started) < time.Minute)
+	})
+
+	t.Run("every invalid variable is reported", func(t *testing.T) {
+		_, err := newTracing(t, map[string]string{
+			"OTEL_RESOURCE_ATTRIBUTES":       "broken",
+			"OTEL_TRACES_EXPORTER":           "zipkin-ish",
+			"OTEL_PROPAGATORS":               "tracecontext,carrier-pigeon",
+			"OTEL_TRACES_SAMPLER":            "traceidratio",
+			"OTEL_TRACES_SAMPLER_ARG":        "2",
+			"OTEL_BSP_SCHEDULE_DELAY":        "soon",
+			"OTEL_BSP_MAX_QUEUE_SIZE":        "10",
+			"OTEL_BSP_MAX_EXPORT_BATCH_SIZE": "20",
+		})
+		var envErr *EnvError
+		assert.Must(t).True(errors.As(err, &envErr))
+		var keys []string
+		for _, p := range envErr.Problems {
+			keys = append(keys, p.Key)
+		}
+		assert.Must(t).ContainExactly([]string{
+			"OTEL_RESOURCE_ATTRIBUTES",
+			"OTEL_TRACES_EXPORTER",
+			"OTEL_PROPAGATORS",
+			"OTEL_TRACES_SAMPLER_ARG",
+			"OTEL_BSP_SCHEDULE_DELAY",
+			"OTEL_BSP_MAX_EXPORT_BATCH_SIZE",
+		}, keys)
+		assert.Must(t).Contain(err.Error(), `OTEL_BSP_SCHEDULE_DELAY="soon"`)
+	})
+}
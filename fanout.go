@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// UpstreamNameKey is the attribute naming the upstream on the span of its call.
+const UpstreamNameKey = attribute.Key("upstream.name")
+
+// Upstream is a backend that App calls for every request.
+type Upstream struct {
+	// Name identifies the upstream in the span names and in the aggregated response.
+	Name string
+	// Host is the base URL of the upstream, like "http://users.internal:8080".
+	Host string
+	// Timeout bounds the call to the upstream. Zero means no timeout other than the one of the request.
+	Timeout time.Duration
+}
+
+// FanOutMode decides how the results of the upstream calls are aggregated.
+type FanOutMode int
+
+const (
+	// AllMustSucceed fails the request as soon as an upstream call fails, and cancels the other calls.
+	// This is the default.
+	AllMustSucceed FanOutMode = iota
+	// BestEffort replies with the results of every upstream, and fails only when all of them failed.
+	BestEffort
+)
+
+// WithUpstreams sets the upstreams that App calls concurrently, one child span each.
+// When it is not used, App calls only the host given to NewHTTPHandler.
+func WithUpstreams(upstreams ...Upstream) Option {
+	return func(c *config) { c.upstreams = append(c.upstreams, upstreams...) }
+}
+
+// WithFanOutMode sets how the results of the upstream calls are aggregated.
+func WithFanOutMode(mode FanOutMode) Option {
+	return func(c *config) { c.fanOutMode = mode }
+}
+
+// upstreamResult is the outcome of the call to an upstream.
+type upstreamResult struct {
+	upstream Upstream
+	resp     *upstreamResponse
+	err      error
+}
+
+// fanOutResponse is the JSON body App replies with when it calls more than one upstream.
+type fanOutResponse struct {
+	Upstreams []fanOutResult `json:"upstreams"`
+}
+
+type fanOutResult struct {
+	Name   string `json:"name"`
+	Status int    `json:"status"`
+	Body   string `json:"body,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+func newFanOutResponse(results []upstreamResult) fanOutResponse {
+	out := fanOutResponse{Upstreams: make([]fanOutResult, 0, len(results))}
+	for _, result := range results {
+		r := fanOutResult{Name: result.upstream.Name}
+		if result.err != nil {
+			r.Status = statusFromError(result.err)
+			r.Error = publicError(result.err, r.Status)
+		} else {
+			r.Status = result.resp.status
+			r.Body = string(result.resp.body)
+		}
+		out.Upstreams = append(out.Upstreams, r)
+	}
+	return out
+}
+
+// fanOut calls the upstreams concurrently and returns their results in the order of the upstreams.
+// In AllMustSucceed mode, the first failure cancels the other calls and is returned as the error.
+// In BestEffort mode, an error is returned only when every call failed.
+func (a *App) fanOut(ctx context.Context) ([]upstreamResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		results  = make([]upstreamResult, len(a.upstreams))
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	for i, u := range a.upstreams {
+		wg.Add(1)
+		go func(i int, u Upstream) {
+			defer wg.Done()
+			resp, err := a.callUpstream(ctx, u)
+			results[i] = upstreamResult{upstream: u, resp: resp, err: err}
+			if err != nil && a.fanOutMode == AllMustSucceed {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(i, u)
+	}
+	wg.Wait()
+
+	if a.fanOutMode == AllMustSucceed {
+		return results, firstErr
+	}
+	for _, result := range results {
+		if result.err == nil {
+			return results, nil
+		}
+	}
+	return results, results[0].err
+}
+
+// callUpstream makes the request to the upstream within a child span of ctx,
+// and reads the entire response.
+func (a *App) callUpstream(ctx context.Context, u Upstream) (_ *upstreamResponse, err error) {
+	ctx, span := a.tracer.Start(ctx, "upstream "+u.Name, trace.WithAttributes(UpstreamNameKey.String(u.Name)))
+	defer func() {
+		if err != nil {
+			a.l.Warn(ctx, "upstream call failed", UpstreamNameKey.String(u.Name), attribute.String("error", err.Error()))
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+	if u.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, u.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.Host+"/", strings.NewReader("Hello, world!"))
+	if err != nil {
+		return nil, &upstreamError{kind: ErrInvalidUpstream, err: fmt.Errorf("%s: %w", u.Name, err)}
+	}
+	if id, ok := RequestIDFromContext(ctx); ok {
+		req.Header.Set(RequestIDHeader, id)
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, &upstreamError{kind: ErrUpstreamUnavailable, err: fmt.Errorf("%s: %w", u.Name, err)}
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &upstreamError{kind: ErrUpstreamUnavailable, err: fmt.Errorf("%s: %w", u.Name, err)}
+	}
+	return &upstreamResponse{status: resp.StatusCode, header: resp.Header, body: body}, nil
+}
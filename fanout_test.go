@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adamluzsi/testcase/assert"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	traceSDK "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestApp_fanOut(t *testing.T) {
+	slow := func(t *testing.T, d time.Duration) *httptest.Server {
+		return newServer(t, func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.Copy(io.Discard, r.Body) // so the server notices when the client goes away
+			select {
+			case <-time.After(d):
+				_, _ = w.Write([]byte("slow"))
+			case <-r.Context().Done():
+			}
+		})
+	}
+	ok := newServer(t, func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("ok")) })
+
+	serve := func(t *testing.T, opts ...Option) (*httptest.ResponseRecorder, []traceSDK.ReadOnlySpan) {
+		tracerProvider, recorder := newRecordingTracerProvider(t)
+		handler := NewHTTPHandler("", nil, propagation.TraceContext{}, tracerProvider, opts...)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rr, recorder.Ended()
+	}
+	spansByName := func(spans []traceSDK.ReadOnlySpan) map[string]traceSDK.ReadOnlySpan {
+		m := make(map[string]traceSDK.ReadOnlySpan, len(spans))
+		for _, span := range spans {
+			m[span.Name()] = span
+		}
+		return m
+	}
+	serverSpan := func(spans []traceSDK.ReadOnlySpan) traceSDK.ReadOnlySpan {
+		for _, span := range spans {
+			if span.SpanKind() == trace.SpanKindServer {
+				return span
+			}
+		}
+		return nil
+	}
+
+	t.Run("upstreams are called concurrently, one child span each", func(t *testing.T) {
+		a, b := slow(t, 50*time.Millisecond), slow(t, 50*time.Millisecond)
+		rr, spans := serve(t, WithUpstreams(Upstream{Name: "a", Host: a.URL}, Upstream{Name: "b", Host: b.URL}))
+		assert.Must(t).Equal(http.StatusOK, rr.Code)
+
+		var body fanOutResponse
+		assert.Must(t).Nil(json.Unmarshal(rr.Body.Bytes(), &body))
+		assert.Must(t).Equal(2, len(body.Upstreams))
+		assert.Must(t).Equal("a", body.Upstreams[0].Name)
+		assert.Must(t).Equal("slow", body.Upstreams[1].Body)
+
+		byName := spansByName(spans)
+		server, spanA, spanB := serverSpan(spans), byName["upstream a"], byName["upstream b"]
+		assert.Must(t).NotNil(server)
+		for _, span := range []traceSDK.ReadOnlySpan{spanA, spanB} {
+			assert.Must(t).NotNil(span)
+			assert.Must(t).Equal(server.SpanContext().SpanID(), span.Parent().SpanID())
+			assert.Must(t).Equal(trace.SpanKindInternal, span.SpanKind())
+		}
+		assert.Must(t).True(spanA.StartTime().Before(spanB.EndTime()) && spanB.StartTime().Before(spanA.EndTime()),
+			"upstream spans should overlap")
+	})
+
+	t.Run("a failing upstream fails the request when all must succeed", func(t *testing.T) {
+		down := httptest.NewServer(http.NotFoundHandler())
+		down.Close()
+		rr, spans := serve(t, WithUpstreams(Upstream{Name: "ok", Host: ok.URL}, Upstream{Name: "down", Host: down.URL}))
+		assert.Must(t).Equal(http.StatusBadGateway, rr.Code)
+		assert.Must(t).Contain(rr.Body.String(), ErrUpstreamUnavailable.Error())
+		assert.Must(t).NotContain(rr.Body.String(), strings.TrimPrefix(down.URL, "http://"))
+		assert.Must(t).Equal(codes.Error, spansByName(spans)["upstream down"].Status().Code)
+		assert.Must(t).Contain(spansByName(spans)["upstream down"].Status().Description, strings.TrimPrefix(down.URL, "http://"))
+	})
+
+	t.Run("a timed out upstream is a gateway timeout", func(t *testing.T) {
+		rr, spans := serve(t, WithUpstreams(
+			Upstream{Name: "ok", Host: ok.URL},
+			Upstream{Name: "slow", Host: slow(t, time.Second).URL, Timeout: 10 * time.Millisecond},
+		))
+		assert.Must(t).Equal(http.StatusGatewayTimeout, rr.Code)
+		assert.Must(t).Equal(codes.Error, spansByName(spans)["upstream slow"].Status().Code)
+	})
+
+	t.Run("best effort replies with the failures next to the successes", func(t *testing.T) {
+		slowSrv := slow(t, time.Second)
+		rr, _ := serve(t, WithFanOutMode(BestEffort), WithUpstreams(
+			Upstream{Name: "ok", Host: ok.URL},
+			Upstream{Name: "slow", Host: slowSrv.URL, Timeout: 10 * time.Millisecond},
+		))
+		assert.Must(t).Equal(http.StatusOK, rr.Code)
+		var body fanOutResponse
+		assert.Must(t).Nil(json.Unmarshal(rr.Body.Bytes(), &body))
+		assert.Must(t).Equal("ok", body.Upstreams[0].Body)
+		assert.Must(t).Equal(http.StatusGatewayTimeout, body.Upstreams[1].Status)
+		assert.Must(t).Equal(ErrUpstreamUnavailable.Error(), body.Upstreams[1].Error)
+		assert.Must(t).NotContain(rr.Body.String(), strings.TrimPrefix(slowSrv.URL, "http://"))
+	})
+
+	t.Run("best effort fails when every upstream failed", func(t *testing.T) {
+		rr, _ := serve(t, WithFanOutMode(BestEffort), WithUpstreams(
+			Upstream{Name: "slow", Host: slow(t, time.Second).URL, Timeout: 10 * time.Millisecond},
+		))
+		assert.Must(t).Equal(http.StatusGatewayTimeout, rr.Code)
+	})
+}
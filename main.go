@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mikejeuga/OTEL_training/agstracing"
+	traceSDK "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if err := run(ctx, os.Args[1:], os.Getenv, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// serverConfig is the configuration of the server command, from its flags and environment variables.
+type serverConfig struct {
+	addr            string
+	upstream        string
+	exporter        string
+	propagators     string
+	configFile      string
+	printConfig     bool
+	shutdownTimeout time.Duration
+}
+
+// parseServerConfig reads the flags, which default to the environment variables named in their usage.
+func parseServerConfig(args []string, getenv func(string) string, output io.Writer) (serverConfig, error) {
+	env := func(key, fallback string) string {
+		if v := getenv(key); v != "" {
+			return v
+		}
+		return fallback
+	}
+	var (
+		cfg             serverConfig
+		shutdownTimeout string
+	)
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.StringVar(&cfg.addr, "addr", env("ADDR", ":8080"), "listen address (env ADDR)")
+	fs.StringVar(&cfg.upstream, "upstream", env("UPSTREAM_HOST", ""), "base URL of the upstream (env UPSTREAM_HOST)")
+	fs.StringVar(&cfg.exporter, "exporter", env("OTEL_TRACES_EXPORTER", "otlp"), "span exporter: otlp, console or none (env OTEL_TRACES_EXPORTER)")
+	fs.StringVar(&cfg.propagators, "propagators", env("OTEL_PROPAGATORS", "tracecontext,baggage"), "comma separated propagators (env OTEL_PROPAGATORS)")
+	fs.StringVar(&cfg.configFile, "config", env("TRACING_CONFIG", ""), "YAML or JSON tracing config file, used instead of the OTEL_* environment (env TRACING_CONFIG)")
+	fs.BoolVar(&cfg.printConfig, "print-config", false, "print the effective tracing config file and exit")
+	fs.StringVar(&shutdownTimeout, "shutdown-timeout", env("SHUTDOWN_TIMEOUT", "10s"), "deadline to drain requests and flush spans (env SHUTDOWN_TIMEOUT)")
+	if err := fs.Parse(args); err != nil {
+		return serverConfig{}, err
+	}
+	d, err := time.ParseDuration(shutdownTimeout)
+	if err != nil {
+		return serverConfig{}, fmt.Errorf("invalid shutdown timeout: %w", err)
+	}
+	cfg.shutdownTimeout = d
+	if cfg.printConfig && cfg.configFile == "" {
+		return serverConfig{}, errors.New("-print-config needs a tracing config file, set -config or TRACING_CONFIG")
+	}
+	if cfg.upstream == "" && !cfg.printConfig {
+		return serverConfig{}, errors.New("missing upstream host, set -upstream or UPSTREAM_HOST")
+	}
+	return cfg, nil
+}
+
+// run starts the server, and stops it gracefully when ctx is done.
+func run(ctx context.Context, args []string, getenv func(string) string, output io.Writer) error {
+	cfg, err := parseServerConfig(args, getenv, output)
+	if err != nil {
+		return err
+	}
+	if cfg.printConfig {
+		tracingConfig, err := LoadTracingConfig(cfg.configFile)
+		if err != nil {
+			return err
+		}
+		return PrintEffectiveConfig(os.Stdout, tracingConfig)
+	}
+	tracing, err := newTracing(ctx, cfg, getenv)
+	if err != nil {
+		return err
+	}
+
+	logger := agstracing.NewLogger(agstracing.NewWriterSink(output, agstracing.FormatJSON))
+	handler := NewHTTPHandler(cfg.upstream, logger, tracing.Propagator, tracing.TracerProvider, WithTraceResponse(), WithRequestID(), WithPanicRecovery(false))
+
+	ln, err := net.Listen("tcp", cfg.addr)
+	if err != nil {
+		return err
+	}
+	logger.Info(ctx, "listening", semconv.NetHostNameKey.String(ln.Addr().String()))
+	return serve(ctx, ln, handler, tracing.TracerProvider, cfg.shutdownTimeout)
+}
+
+// newTracing builds the tracing from the config file when there is one, and from the environment otherwise.
+func newTracing(ctx context.Context, cfg serverConfig, getenv func(string) string) (Tracing, error) {
+	if cfg.configFile != "" {
+		tracingConfig, err := LoadTracingConfig(cfg.configFile)
+		if err != nil {
+			return Tracing{}, err
+		}
+		return NewTracingFromConfig(ctx, tracingConfig)
+	}
+	// the flags take precedence over the environment, and the service is named after the command by default.
+	return NewTracingFromEnv(ctx, func(key string) string {
+		switch key {
+		case "OTEL_TRACES_EXPORTER":
+			return cfg.exporter
+		case "OTEL_PROPAGATORS":
+			return cfg.propagators
+		case "OTEL_SERVICE_NAME":
+			if getenv(key) == "" {
+				return name
+			}
+		}
+		return getenv(key)
+	})
+}
+
+// serve serves handler on ln until ctx is done.
+// Then, within the shutdown timeout, it drains the in-flight requests,
+// and flushes then shuts down the tracer provider, so the spans of the drained requests are not lost.
+func serve(ctx context.Context, ln net.Listener, handler http.Handler, tracerProvider *traceSDK.TracerProvider, shutdownTimeout time.Duration) error {
+	srv := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Serve(ln) }()
+
+	select {
+	case err := <-errc:
+		_ = tracerProvider.Shutdown(context.Background())
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	var errs []string
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Sprintf("draining requests: %v", err))
+	}
+	if err := tracerProvider.ForceFlush(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Sprintf("flushing spans: %v", err))
+	}
+	if err := tracerProvider.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Sprintf("shutting down tracer provider: %v", err))
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
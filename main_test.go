@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/adamluzsi/testcase/assert"
+	"go.opentelemetry.io/otel/propagation"
+	traceSDK "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestServe_gracefulShutdown(t *testing.T) {
+	exporter := keepingExporter{tracetest.NewInMemoryExporter()}
+	// a long batch timeout, so only the flush on shutdown exports the spans.
+	tracerProvider := traceSDK.NewTracerProvider(traceSDK.WithBatcher(exporter, traceSDK.WithBatchTimeout(time.Hour)))
+	started := make(chan struct{})
+	handler := traceIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		_, _ = w.Write([]byte("drained"))
+	}), propagation.TraceContext{}, tracerProvider, newConfig(nil))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Must(t).Nil(err)
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- serve(ctx, ln, handler, tracerProvider, time.Second) }()
+
+	type result struct {
+		body string
+		err  error
+	}
+	responses := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/")
+		if err != nil {
+			responses <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		responses <- result{body: string(body), err: err}
+	}()
+
+	<-started
+	cancel() // like SIGTERM, while the request is in flight
+	assert.Must(t).Nil(<-served)
+	res := <-responses
+	assert.Must(t).Nil(res.err)
+	assert.Must(t).Equal("drained", res.body)
+	assert.Must(t).Equal(1, len(exporter.GetSpans()))
+}
+
+// keepingExporter keeps the exported spans after Shutdown, unlike tracetest.InMemoryExporter.
+type keepingExporter struct{ *tracetest.InMemoryExporter }
+
+func (keepingExporter) Shutdown(context.Context) error { return nil }
+
+func TestParseServerConfig(t *testing.T) {
+	env := map[string]string{"UPSTREAM_HOST": "http://env.example.com", "ADDR": ":9090"}
+	cfg, err := parseServerConfig([]string{"-upstream", "http://flag.example.com", "-shutdown-timeout", "3s"},
+		func(key string) string { return env[key] }, io.Discard)
+	assert.Must(t).Nil(err)
+	assert.Must(t).Equal(serverConfig{
+		addr:            ":9090",
+		upstream:        "http://flag.example.com",
+		exporter:        "otlp",
+		propagators:     "tracecontext,baggage",
+		shutdownTimeout: 3 * time.Second,
+	}, cfg)
+
+	_, err = parseServerConfig(nil, func(string) string { return "" }, io.Discard)
+	assert.Must(t).NotNil(err)
+	_, err = parseServerConfig([]string{"-upstream", "http://x", "-shutdown-timeout", "soon"}, func(string) string { return "" }, io.Discard)
+	assert.Must(t).NotNil(err)
+}
+
+func TestNewPropagator(t *testing.T) {
+	p, err := newPropagator("tracecontext, baggage")
+	assert.Must(t).Nil(err)
+	assert.Must(t).ContainExactly([]string{"traceparent", "tracestate", "baggage"}, p.Fields())
+
+	_, err = newPropagator("tracecontext,carrier-pigeon")
+	assert.Must(t).NotNil(err)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net/http"
+	"runtime/debug"
+	"strings"
+
+	"github.com/mikejeuga/OTEL_training/agstracing"
+	"github.com/mikejeuga/OTEL_training/agstracing/httpadapter"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// instrumentationName is the import path of this package,
+// used as the instrumentation scope of the tracer that creates the server spans.
+const instrumentationName = "github.com/mikejeuga/OTEL_training"
+
+// instrumentationVersion reports the module version the binary was built with,
+// so the instrumentation scope follows the package instead of a hard-coded literal.
+func instrumentationVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok || info.Main.Version == "" {
+		return "(devel)"
+	}
+	return info.Main.Version
+}
+
+// Option configures the http.Handler made by NewHTTPHandler.
+type Option func(*config)
+
+type config struct {
+	routeResolver       RouteResolver
+	errorOn4xx          bool
+	serverName          string
+	attributeExtractors []AttributeExtractor
+	recoverPanics       bool
+	rePanic             bool
+	trustPolicy         TrustPolicy
+	traceResponse       bool
+	clientOptions       []httpadapter.Option
+	upstreams           []Upstream
+	fanOutMode          FanOutMode
+	debugHook           agstracing.DebugHook
+	logger              *agstracing.Logger
+	requestID           bool
+}
+
+func newConfig(opts []Option) config {
+	c := config{debugHook: agstracing.NoopDebugHook, logger: agstracing.NewLogger(agstracing.DiscardSink)}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// RouteResolver returns the route template that will serve the request, like "/users/{id}".
+// An empty string means the route is unknown.
+type RouteResolver func(r *http.Request) string
+
+// WithRouteResolver sets the hook that names the server spans after the matched route template.
+func WithRouteResolver(resolver RouteResolver) Option {
+	return func(c *config) { c.routeResolver = resolver }
+}
+
+// AttributeExtractor returns extra attributes for the server span of a request.
+type AttributeExtractor func(r *http.Request) []attribute.KeyValue
+
+// WithAttributeExtractors adds attribute extractors that are called for every request,
+// and their attributes are set on the server span at its start.
+func WithAttributeExtractors(extractors ...AttributeExtractor) Option {
+	return func(c *config) { c.attributeExtractors = append(c.attributeExtractors, extractors...) }
+}
+
+// WithServerName sets the http.server_name attribute of the server spans.
+func WithServerName(name string) Option {
+	return func(c *config) { c.serverName = name }
+}
+
+// WithErrorStatusOn4xx marks the server span as Error for 4xx responses too, not only for 5xx ones.
+func WithErrorStatusOn4xx() Option {
+	return func(c *config) { c.errorOn4xx = true }
+}
+
+// WithPanicRecovery recovers panics of the wrapped http.Handler,
+// records them as an "exception" event on the server span and replies with 500.
+// When rePanic is true, the panic is raised again after it is recorded and the 500 is sent.
+func WithPanicRecovery(rePanic bool) Option {
+	return func(c *config) {
+		c.recoverPanics = true
+		c.rePanic = rePanic
+	}
+}
+
+// WithTraceResponse replies with the W3C Trace Context Level 2 traceresponse header,
+// so callers learn the trace ID of the server span, even when they sent no trace context.
+func WithTraceResponse() Option {
+	return func(c *config) { c.traceResponse = true }
+}
+
+// WithDebugHook sets the hook that receives the diagnostics of the propagation,
+// from the header carrier, the middleware and the transport of App. By default, they are discarded.
+func WithDebugHook(hook agstracing.DebugHook) Option {
+	return func(c *config) { c.debugHook = hook }
+}
+
+// WithClientOptions configures the httpadapter.RoundTripper that App uses for its outgoing requests,
+// like the httpadapter.DestinationPolicy that decides which upstreams receive the trace context.
+func WithClientOptions(opts ...httpadapter.Option) Option {
+	return func(c *config) { c.clientOptions = append(c.clientOptions, opts...) }
+}
+
+// ServeMuxRouteResolver resolves routes from the patterns registered on an http.ServeMux,
+// including the method and wildcard patterns of Go 1.22, like "GET /users/{id}".
+// The method of a pattern is left out of the route, as http.route holds only the path template.
+func ServeMuxRouteResolver(mux *http.ServeMux) RouteResolver {
+	return func(r *http.Request) string {
+		_, pattern := mux.Handler(r)
+		if _, path, ok := strings.Cut(pattern, " "); ok {
+			return path
+		}
+		return pattern
+	}
+}
+
+// spanName formats the server span name as "METHOD /route",
+// and falls back to "HTTP METHOD" when the route is unknown, to keep the span name low cardinality.
+func spanName(r *http.Request, route string) string {
+	method := r.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	if route == "" {
+		return "HTTP " + method
+	}
+	if strings.Contains(route, " ") { // a RouteResolver may already include the method, like "GET /users/{id}"
+		return route
+	}
+	return method + " " + route
+}
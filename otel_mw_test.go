@@ -1,7 +1,371 @@
 package main
 
-import "testing"
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/adamluzsi/testcase/assert"
+	"github.com/mikejeuga/OTEL_training/agstracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	traceSDK "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newRecordingTracerProvider(tb testing.TB) (*traceSDK.TracerProvider, *tracetest.SpanRecorder) {
+	tb.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	tracerProvider := traceSDK.NewTracerProvider(traceSDK.WithSpanProcessor(recorder))
+	return tracerProvider, recorder
+}
+
+func serveMW(tb testing.TB, next http.Handler, opts ...Option) (*httptest.ResponseRecorder, []traceSDK.ReadOnlySpan) {
+	tb.Helper()
+	tracerProvider, recorder := newRecordingTracerProvider(tb)
+	mw := traceIDMiddleware(next, propagation.TraceContext{}, tracerProvider, newConfig(opts))
+	rr := httptest.NewRecorder()
+	mw.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/users/123", nil))
+	return rr, recorder.Ended()
+}
 
 func TestOTELMW(t *testing.T) {
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	t.Run("without route resolver the span name falls back to the method", func(t *testing.T) {
+		_, spans := serveMW(t, noop)
+		assert.Must(t).Equal(1, len(spans))
+		assert.Must(t).Equal("HTTP GET", spans[0].Name())
+	})
+
+	t.Run("route resolver names the span after the route template", func(t *testing.T) {
+		_, spans := serveMW(t, noop, WithRouteResolver(func(r *http.Request) string { return "/users/{id}" }))
+		assert.Must(t).Equal(1, len(spans))
+		assert.Must(t).Equal("GET /users/{id}", spans[0].Name())
+		assert.Must(t).Equal("/users/{id}", attributeMap(spans[0].Attributes())[semconv.HTTPRouteKey].AsString())
+	})
+
+	t.Run("ServeMux patterns are used as route", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.Handle("/users/", noop)
+		_, spans := serveMW(t, noop, WithRouteResolver(ServeMuxRouteResolver(mux)))
+		assert.Must(t).Equal(1, len(spans))
+		assert.Must(t).Equal("GET /users/", spans[0].Name())
+	})
+
+	t.Run("ServeMux method and wildcard patterns are used as span name", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.Handle("GET /users/{id}", noop)
+		_, spans := serveMW(t, noop, WithRouteResolver(ServeMuxRouteResolver(mux)))
+		assert.Must(t).Equal(1, len(spans))
+		assert.Must(t).Equal("GET /users/{id}", spans[0].Name())
+		assert.Must(t).Equal("/users/{id}", attributeMap(spans[0].Attributes())[semconv.HTTPRouteKey].AsString())
+	})
+
+	t.Run("tracer is named after the package", func(t *testing.T) {
+		_, spans := serveMW(t, noop)
+		assert.Must(t).Equal(1, len(spans))
+		assert.Must(t).Equal(instrumentationName, spans[0].InstrumentationLibrary().Name)
+		assert.Must(t).NotEmpty(spans[0].InstrumentationLibrary().Version)
+	})
+}
+
+func TestOTELMW_attributes(t *testing.T) {
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	t.Run("server span carries the HTTP server semantic conventions", func(t *testing.T) {
+		tracerProvider, recorder := newRecordingTracerProvider(t)
+		mw := traceIDMiddleware(noop, propagation.TraceContext{}, tracerProvider, newConfig([]Option{
+			WithServerName("ags"),
+			WithRouteResolver(func(r *http.Request) string { return "/users/{id}" }),
+		}))
+		req := httptest.NewRequest(http.MethodPost, "/users/123?q=1", strings.NewReader("Hello"))
+		req.Header.Set("User-Agent", "otel-test")
+		mw.ServeHTTP(httptest.NewRecorder(), req)
+
+		spans := recorder.Ended()
+		assert.Must(t).Equal(1, len(spans))
+		assert.Must(t).Equal(trace.SpanKindServer, spans[0].SpanKind())
+		attrs := attributeMap(spans[0].Attributes())
+		assert.Must(t).Equal(http.MethodPost, attrs[semconv.HTTPMethodKey].AsString())
+		assert.Must(t).Equal("/users/123?q=1", attrs[semconv.HTTPTargetKey].AsString())
+		assert.Must(t).Equal("/users/{id}", attrs[semconv.HTTPRouteKey].AsString())
+		assert.Must(t).Equal("http", attrs[semconv.HTTPSchemeKey].AsString())
+		assert.Must(t).Equal("example.com", attrs[semconv.HTTPHostKey].AsString())
+		assert.Must(t).Equal("ags", attrs[semconv.HTTPServerNameKey].AsString())
+		assert.Must(t).Equal("192.0.2.1", attrs[semconv.NetPeerIPKey].AsString())
+		assert.Must(t).Equal("otel-test", attrs[semconv.HTTPUserAgentKey].AsString())
+		assert.Must(t).Equal(int64(len("Hello")), attrs[semconv.HTTPRequestContentLengthKey].AsInt64())
+	})
+
+	t.Run("attribute extractors add their attributes", func(t *testing.T) {
+		_, spans := serveMW(t, noop, WithAttributeExtractors(func(r *http.Request) []attribute.KeyValue {
+			return []attribute.KeyValue{attribute.String("tenant", "acme")}
+		}))
+		assert.Must(t).Equal(1, len(spans))
+		assert.Must(t).Equal("acme", attributeMap(spans[0].Attributes())["tenant"].AsString())
+	})
+}
+
+func TestOTELMW_response(t *testing.T) {
+	t.Run("status code and response size are recorded", func(t *testing.T) {
+		_, spans := serveMW(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = w.Write([]byte("Hello, world!"))
+		}))
+		assert.Must(t).Equal(1, len(spans))
+		attrs := attributeMap(spans[0].Attributes())
+		assert.Must(t).Equal(int64(http.StatusAccepted), attrs[semconv.HTTPStatusCodeKey].AsInt64())
+		assert.Must(t).Equal(int64(len("Hello, world!")), attrs[semconv.HTTPResponseContentLengthKey].AsInt64())
+		assert.Must(t).Equal(codes.Unset, spans[0].Status().Code)
+	})
+
+	t.Run("implicit 200 is recorded when the handler writes nothing", func(t *testing.T) {
+		_, spans := serveMW(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		assert.Must(t).Equal(int64(http.StatusOK), attributeMap(spans[0].Attributes())[semconv.HTTPStatusCodeKey].AsInt64())
+	})
+
+	t.Run("informational status codes precede the recorded one", func(t *testing.T) {
+		// httptest.ResponseRecorder takes 1xx codes as final, so a real server is used.
+		tracerProvider, recorder := newRecordingTracerProvider(t)
+		srv := httptest.NewServer(traceIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Link", "</style.css>; rel=preload; as=style")
+			w.WriteHeader(http.StatusEarlyHints)
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte("Hello, world!"))
+		}), propagation.TraceContext{}, tracerProvider, newConfig(nil)))
+		t.Cleanup(srv.Close)
+
+		resp, err := http.Get(srv.URL)
+		assert.Must(t).Nil(err)
+		body, err := io.ReadAll(resp.Body)
+		assert.Must(t).Nil(err)
+		assert.Must(t).Nil(resp.Body.Close())
+		assert.Must(t).Equal(http.StatusOK, resp.StatusCode)
+		assert.Must(t).Equal("Hello, world!", string(body))
+
+		spans := recorder.Ended()
+		assert.Must(t).Equal(1, len(spans))
+		attrs := attributeMap(spans[0].Attributes())
+		assert.Must(t).Equal(int64(http.StatusOK), attrs[semconv.HTTPStatusCodeKey].AsInt64())
+		assert.Must(t).Equal(int64(len("Hello, world!")), attrs[semconv.HTTPResponseContentLengthKey].AsInt64())
+	})
+
+	t.Run("5xx marks the span as error", func(t *testing.T) {
+		_, spans := serveMW(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		assert.Must(t).Equal(codes.Error, spans[0].Status().Code)
+	})
+
+	t.Run("4xx is not an error by default", func(t *testing.T) {
+		_, spans := serveMW(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		assert.Must(t).Equal(codes.Unset, spans[0].Status().Code)
+	})
+
+	t.Run("4xx is an error when WithErrorStatusOn4xx is used", func(t *testing.T) {
+		_, spans := serveMW(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}), WithErrorStatusOn4xx())
+		assert.Must(t).Equal(codes.Error, spans[0].Status().Code)
+	})
+
+	t.Run("optional interfaces are forwarded", func(t *testing.T) {
+		rr, spans := serveMW(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			f, ok := w.(http.Flusher)
+			assert.Must(t).True(ok)
+			f.Flush()
+			rf, ok := w.(io.ReaderFrom)
+			assert.Must(t).True(ok)
+			_, err := rf.ReadFrom(strings.NewReader("streamed"))
+			assert.Must(t).Nil(err)
+		}))
+		assert.Must(t).True(rr.Flushed)
+		assert.Must(t).Equal("streamed", rr.Body.String())
+		assert.Must(t).Equal(int64(len("streamed")), attributeMap(spans[0].Attributes())[semconv.HTTPResponseContentLengthKey].AsInt64())
+	})
+
+	t.Run("Hijack and Push report when the underlying writer does not support them", func(t *testing.T) {
+		rw := newResponseWriter(httptest.NewRecorder())
+		_, _, err := rw.Hijack()
+		assert.Must(t).NotNil(err)
+		assert.Must(t).ErrorIs(http.ErrNotSupported, rw.Push("/style.css", nil))
+	})
+}
+
+func TestOTELMW_panicRecovery(t *testing.T) {
+	boom := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic("boom") })
+
+	t.Run("panic is recorded as exception event and answered with 500", func(t *testing.T) {
+		rr, spans := serveMW(t, boom, WithPanicRecovery(false))
+		assert.Must(t).Equal(http.StatusInternalServerError, rr.Code)
+		assert.Must(t).Equal(1, len(spans))
+		assert.Must(t).Equal(codes.Error, spans[0].Status().Code)
+		assert.Must(t).Equal("boom", spans[0].Status().Description)
+		assert.Must(t).Equal(1, len(spans[0].Events()))
+		event := spans[0].Events()[0]
+		assert.Must(t).Equal(semconv.ExceptionEventName, event.Name)
+		attrs := attributeMap(event.Attributes)
+		assert.Must(t).Equal("string", attrs[semconv.ExceptionTypeKey].AsString())
+		assert.Must(t).Equal("boom", attrs[semconv.ExceptionMessageKey].AsString())
+		assert.Must(t).Contain(attrs[semconv.ExceptionStacktraceKey].AsString(), "recoverPanic")
+		assert.Must(t).Equal(int64(http.StatusInternalServerError), attributeMap(spans[0].Attributes())[semconv.HTTPStatusCodeKey].AsInt64())
+	})
+
+	t.Run("panic is raised again when rePanic is set, after the span ended", func(t *testing.T) {
+		tracerProvider, recorder := newRecordingTracerProvider(t)
+		mw := traceIDMiddleware(boom, propagation.TraceContext{}, tracerProvider, newConfig([]Option{WithPanicRecovery(true)}))
+		assert.Must(t).Panic(func() {
+			mw.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		})
+		assert.Must(t).Equal(1, len(recorder.Ended()))
+		assert.Must(t).Equal(codes.Error, recorder.Ended()[0].Status().Code)
+	})
+
+	t.Run("the client receives the 500 when the panic is raised again", func(t *testing.T) {
+		tracerProvider, _ := newRecordingTracerProvider(t)
+		srv := httptest.NewUnstartedServer(traceIDMiddleware(boom, propagation.TraceContext{}, tracerProvider, newConfig([]Option{WithPanicRecovery(true)})))
+		srv.Config.ErrorLog = log.New(io.Discard, "", 0) // net/http logs the re-raised panic
+		srv.Start()
+		t.Cleanup(srv.Close)
+
+		resp, err := srv.Client().Get(srv.URL)
+		assert.Must(t).Nil(err)
+		defer resp.Body.Close()
+		assert.Must(t).Equal(http.StatusInternalServerError, resp.StatusCode)
+		body, err := io.ReadAll(resp.Body)
+		assert.Must(t).Nil(err)
+		assert.Must(t).Equal(http.StatusText(http.StatusInternalServerError)+"\n", string(body))
+	})
+
+	t.Run("panics are not recovered by default", func(t *testing.T) {
+		tracerProvider, _ := newRecordingTracerProvider(t)
+		mw := traceIDMiddleware(boom, propagation.TraceContext{}, tracerProvider, newConfig(nil))
+		assert.Must(t).Panic(func() {
+			mw.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		})
+	})
+}
+
+func attributeMap(kvs []attribute.KeyValue) map[attribute.Key]attribute.Value {
+	m := make(map[attribute.Key]attribute.Value, len(kvs))
+	for _, kv := range kvs {
+		m[kv.Key] = kv.Value
+	}
+	return m
+}
+
+func TestSpanName(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/users/123", nil)
+	assert.Must(t).Equal("HTTP POST", spanName(r, ""))
+	assert.Must(t).Equal("POST /users/{id}", spanName(r, "/users/{id}"))
+	assert.Must(t).Equal("POST /users/{id}", spanName(r, "POST /users/{id}"))
+}
+
+func TestOTELMW_trustPolicy(t *testing.T) {
+	tID, sID := newTraceID()
+	propagator := propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+	internal, err := TrustNetworks("10.0.0.0/8")
+	assert.Must(t).Nil(err)
+
+	serve := func(t *testing.T, remoteAddr string) (traceSDK.ReadOnlySpan, baggage.Baggage) {
+		var bag baggage.Baggage
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { bag = baggage.FromContext(r.Context()) })
+		tracerProvider, recorder := newRecordingTracerProvider(t)
+		mw := traceIDMiddleware(next, propagator, tracerProvider, newConfig([]Option{WithTrustPolicy(internal)}))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set(headerKey, fmt.Sprintf("00-%s-%s-01", tID, sID)) // sampled, so the trusted span is recorded
+		req.Header.Set("baggage", "user=123")
+		mw.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Must(t).Equal(1, len(recorder.Ended()))
+		return recorder.Ended()[0], bag
+	}
+
+	t.Run("trusted callers parent the server span", func(t *testing.T) {
+		span, bag := serve(t, "10.1.2.3:1234")
+		assert.Must(t).Equal(tID, span.SpanContext().TraceID())
+		assert.Must(t).Equal(sID, span.Parent().SpanID())
+		assert.Must(t).Equal(0, len(span.Links()))
+		assert.Must(t).Equal("123", bag.Member("user").Value())
+	})
+
+	t.Run("untrusted callers are only linked to a new root span, and their baggage is dropped", func(t *testing.T) {
+		span, bag := serve(t, "203.0.113.1:1234")
+		assert.Must(t).NotEqual(tID, span.SpanContext().TraceID())
+		assert.Must(t).False(span.Parent().IsValid())
+		assert.Must(t).Equal(1, len(span.Links()))
+		assert.Must(t).Equal(tID, span.Links()[0].SpanContext.TraceID())
+		assert.Must(t).Equal(sID, span.Links()[0].SpanContext.SpanID())
+		assert.Must(t).Equal(0, bag.Len())
+	})
+}
+
+func TestTrustPolicy(t *testing.T) {
+	_, err := TrustNetworks("not-a-cidr")
+	assert.Must(t).NotNil(err)
+
+	internal, err := TrustNetworks("192.168.0.0/16")
+	assert.Must(t).Nil(err)
+	policy := TrustAny(internal, TrustHeader("X-Gateway", "ags"), TrustHeader("X-Internal", ""))
+
+	for name, tc := range map[string]struct {
+		remoteAddr string
+		header     http.Header
+		expected   bool
+	}{
+		"internal network":      {remoteAddr: "192.168.1.1:80", expected: true},
+		"external network":      {remoteAddr: "203.0.113.1:80", expected: false},
+		"gateway header":        {remoteAddr: "203.0.113.1:80", header: http.Header{"X-Gateway": {"ags"}}, expected: true},
+		"wrong gateway header":  {remoteAddr: "203.0.113.1:80", header: http.Header{"X-Gateway": {"evil"}}, expected: false},
+		"header presence":       {remoteAddr: "203.0.113.1:80", header: http.Header{"X-Internal": {"1"}}, expected: true},
+		"unparsable remoteAddr": {remoteAddr: "somewhere", expected: false},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tc.remoteAddr
+		for k, vs := range tc.header {
+			req.Header[k] = vs
+		}
+		assert.Must(t).Equal(tc.expected, policy(req), name)
+	}
+}
+
+func TestOTELMW_traceResponse(t *testing.T) {
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	t.Run("traceresponse is not sent by default", func(t *testing.T) {
+		rr, _ := serveMW(t, noop)
+		assert.Must(t).Empty(rr.Header().Get(traceresponseHeader))
+	})
+
+	t.Run("traceresponse tells the server span", func(t *testing.T) {
+		rr, spans := serveMW(t, noop, WithTraceResponse())
+		assert.Must(t).Equal(1, len(spans))
+		sc := spans[0].SpanContext()
+		assert.Must(t).Equal(fmt.Sprintf("00-%s-%s-01", sc.TraceID(), sc.SpanID()), rr.Header().Get(traceresponseHeader))
+	})
+}
+
+func TestOTELMW_debugHook(t *testing.T) {
+	buf := &bytes.Buffer{}
+	tracerProvider, _ := newRecordingTracerProvider(t)
+	mw := traceIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), propagation.TraceContext{}, tracerProvider,
+		newConfig([]Option{WithDebugHook(agstracing.NewWriterDebugHook(buf, agstracing.LevelDebug))}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(headerKey, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	mw.ServeHTTP(httptest.NewRecorder(), req)
 
+	assert.Must(t).Contain(buf.String(), `msg="header get" key="traceparent" value="00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"`)
+	assert.Must(t).Contain(buf.String(), `msg="extracted trace context" valid="true" trace_id="0af7651916cd43dd8448eb211c80319c"`)
 }
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recoverPanic is deferred by the middleware to turn a panic of the next http.Handler into telemetry.
+// It records an "exception" event on the span, sets the span status to Error and replies with 500,
+// then re-panics when rePanic is set, so the existing crash handling still sees the panic.
+// The 500 is flushed before re-panicking, as net/http drops the buffered response of a panicking handler.
+//
+// http.ErrAbortHandler is always re-panicked, as it is how a handler asks net/http to abort the response.
+func recoverPanic(span trace.Span, rw *responseWriter, rePanic bool) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	escaped := rePanic || v == http.ErrAbortHandler
+	msg := fmt.Sprint(v)
+	span.AddEvent(semconv.ExceptionEventName, trace.WithAttributes(
+		semconv.ExceptionTypeKey.String(fmt.Sprintf("%T", v)),
+		semconv.ExceptionMessageKey.String(msg),
+		semconv.ExceptionStacktraceKey.String(string(debug.Stack())),
+		semconv.ExceptionEscapedKey.Bool(escaped),
+	))
+	if !rw.wroteHeader && !rw.hijacked && v != http.ErrAbortHandler {
+		writeInternalServerError(rw, escaped)
+	}
+	span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(rw.Status())...)
+	span.SetStatus(codes.Error, msg)
+	if escaped {
+		panic(v)
+	}
+}
+
+// writeInternalServerError replies like http.Error, with a Content-Length so the client reads the whole body
+// even when flush is set and the connection is closed right after.
+func writeInternalServerError(rw *responseWriter, flush bool) {
+	body := http.StatusText(http.StatusInternalServerError) + "\n"
+	h := rw.Header()
+	h.Set("Content-Type", "text/plain; charset=utf-8")
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	h.Set("X-Content-Type-Options", "nosniff")
+	rw.WriteHeader(http.StatusInternalServerError)
+	_, _ = io.WriteString(rw, body)
+	if flush {
+		rw.Flush()
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	crand "crypto/rand"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// RequestIDHeader is the header that carries the request ID, adopted from the caller and sent to the upstreams.
+	RequestIDHeader = "X-Request-ID"
+	// CorrelationIDHeader is adopted as the request ID when the caller sends no X-Request-ID.
+	CorrelationIDHeader = "X-Correlation-ID"
+
+	// RequestIDKey is the attribute of the server span, and the baggage member, that hold the request ID.
+	RequestIDKey = attribute.Key("request.id")
+
+	// maxRequestIDLength bounds the adopted request IDs, longer ones are replaced by a generated one.
+	maxRequestIDLength = 128
+)
+
+// WithRequestID bridges the request IDs searched by the ops tooling with the traces.
+// The request ID is adopted from the X-Request-ID or X-Correlation-ID header of the caller,
+// or generated when there is none or when it is not a valid baggage value of at most 128 characters.
+// It is set on the server span and in the baggage, echoed on the response,
+// and sent in the X-Request-ID header of the calls to the upstreams.
+func WithRequestID() Option {
+	return func(c *config) { c.requestID = true }
+}
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the request ID set by the middleware of WithRequestID.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok
+}
+
+// requestIDMiddleware runs within traceIDMiddleware, so the request ID is set on its server span.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		id, header := requestIDFromHeaders(r.Header)
+		member, err := baggage.NewMember(string(RequestIDKey), id)
+		if err != nil || id == "" || len(id) > maxRequestIDLength {
+			id, header = newRequestID(), RequestIDHeader
+			member, _ = baggage.NewMember(string(RequestIDKey), id)
+		}
+		if bag, err := baggage.FromContext(ctx).SetMember(member); err == nil {
+			ctx = baggage.ContextWithBaggage(ctx, bag)
+		}
+		ctx = context.WithValue(ctx, requestIDKey{}, id)
+		trace.SpanFromContext(ctx).SetAttributes(RequestIDKey.String(id))
+
+		w.Header().Set(RequestIDHeader, id)
+		if header == CorrelationIDHeader {
+			w.Header().Set(CorrelationIDHeader, id)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestIDFromHeaders returns the request ID of the caller, and the header it came from.
+func requestIDFromHeaders(h http.Header) (id, header string) {
+	for _, key := range []string{RequestIDHeader, CorrelationIDHeader} {
+		if v := h.Get(key); v != "" {
+			return v, key
+		}
+	}
+	return "", RequestIDHeader
+}
+
+// newRequestID returns a random UUID, like "0b6f4c4e-7d5a-4f32-9c2b-3a1e8f0d6c71".
+func newRequestID() string {
+	var b [16]byte
+	_, _ = crand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
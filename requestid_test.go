@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/adamluzsi/testcase/assert"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestRequestID(t *testing.T) {
+	var upstreamHeader http.Header
+	upstream := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		upstreamHeader = r.Header.Clone()
+		_, _ = w.Write([]byte("ok"))
+	})
+	serve := func(t *testing.T, header http.Header) *httptest.ResponseRecorder {
+		tracerProvider, recorder := newRecordingTracerProvider(t)
+		propagator := propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+		handler := NewHTTPHandler(upstream.URL, nil, propagator, tracerProvider, WithRequestID())
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		for k, v := range header {
+			req.Header[http.CanonicalHeaderKey(k)] = v
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Must(t).Equal(http.StatusOK, rr.Code)
+
+		for _, span := range recorder.Ended() {
+			if span.SpanKind() == trace.SpanKindServer {
+				assert.Must(t).Equal(rr.Header().Get(RequestIDHeader), attributeMap(span.Attributes())[RequestIDKey].AsString())
+			}
+		}
+		return rr
+	}
+	upstreamBaggage := func(t *testing.T) baggage.Baggage {
+		bag, err := baggage.Parse(upstreamHeader.Get("baggage"))
+		assert.Must(t).Nil(err)
+		return bag
+	}
+
+	t.Run("X-Request-ID is adopted, echoed and forwarded", func(t *testing.T) {
+		rr := serve(t, http.Header{RequestIDHeader: {"req-42"}})
+		assert.Must(t).Equal("req-42", rr.Header().Get(RequestIDHeader))
+		assert.Must(t).Equal("", rr.Header().Get(CorrelationIDHeader))
+		assert.Must(t).Equal("req-42", upstreamHeader.Get(RequestIDHeader))
+		assert.Must(t).Equal("req-42", upstreamBaggage(t).Member(string(RequestIDKey)).Value())
+	})
+
+	t.Run("X-Correlation-ID is adopted when there is no X-Request-ID", func(t *testing.T) {
+		rr := serve(t, http.Header{CorrelationIDHeader: {"corr-7"}})
+		assert.Must(t).Equal("corr-7", rr.Header().Get(RequestIDHeader))
+		assert.Must(t).Equal("corr-7", rr.Header().Get(CorrelationIDHeader))
+		assert.Must(t).Equal("corr-7", upstreamHeader.Get(RequestIDHeader))
+	})
+
+	t.Run("the caller baggage is kept", func(t *testing.T) {
+		serve(t, http.Header{RequestIDHeader: {"req-42"}, "Baggage": {"tenant=acme"}})
+		bag := upstreamBaggage(t)
+		assert.Must(t).Equal("acme", bag.Member("tenant").Value())
+		assert.Must(t).Equal("req-42", bag.Member(string(RequestIDKey)).Value())
+	})
+
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	for name, header := range map[string]http.Header{
+		"a request ID is generated when there is none": {},
+		"an invalid request ID is replaced":            {RequestIDHeader: {"two words"}},
+		"a too long request ID is replaced":            {RequestIDHeader: {strings.Repeat("x", maxRequestIDLength+1)}},
+	} {
+		header := header
+		t.Run(name, func(t *testing.T) {
+			rr := serve(t, header)
+			id := rr.Header().Get(RequestIDHeader)
+			assert.Must(t).True(uuid.MatchString(id), id)
+			assert.Must(t).Equal(id, upstreamHeader.Get(RequestIDHeader))
+		})
+	}
+
+	t.Run("request IDs are not handled without the option", func(t *testing.T) {
+		tracerProvider, _ := newRecordingTracerProvider(t)
+		handler := NewHTTPHandler(upstream.URL, nil, propagation.TraceContext{}, tracerProvider)
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(RequestIDHeader, "req-42")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Must(t).Equal("", rr.Header().Get(RequestIDHeader))
+		assert.Must(t).Equal("", upstreamHeader.Get(RequestIDHeader))
+	})
+}
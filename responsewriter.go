@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+)
+
+// responseWriter captures the status code and the response size written by the next http.Handler,
+// so the middleware can record them on the server span.
+//
+// It forwards http.Flusher, http.Hijacker, http.Pusher and io.ReaderFrom to the wrapped http.ResponseWriter,
+// so streaming and websocket handlers keep working behind the middleware.
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	written     int64
+	wroteHeader bool
+	hijacked    bool
+}
+
+var (
+	_ http.ResponseWriter = &responseWriter{}
+	_ http.Flusher        = &responseWriter{}
+	_ http.Hijacker       = &responseWriter{}
+	_ http.Pusher         = &responseWriter{}
+	_ io.ReaderFrom       = &responseWriter{}
+)
+
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	return &responseWriter{ResponseWriter: w, status: http.StatusOK}
+}
+
+// Status returns the status code sent to the client.
+// When the handler wrote nothing, it is the implicit http.StatusOK.
+func (rw *responseWriter) Status() int { return rw.status }
+
+// Written returns the number of body bytes sent to the client.
+func (rw *responseWriter) Written() int64 { return rw.written }
+
+// WriteHeader records the first final status code.
+// Informational 1xx codes, like 103 Early Hints, may precede it, so only 101 Switching Protocols is final among them.
+func (rw *responseWriter) WriteHeader(code int) {
+	informational := 100 <= code && code <= 199 && code != http.StatusSwitchingProtocols
+	if !rw.wroteHeader && !informational {
+		rw.wroteHeader = true
+		rw.status = code
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseWriter) Write(p []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	n, err := rw.ResponseWriter.Write(p)
+	rw.written += int64(n)
+	return n, err
+}
+
+func (rw *responseWriter) Flush() {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T does not implement http.Hijacker", rw.ResponseWriter)
+	}
+	conn, brw, err := h.Hijack()
+	if err == nil {
+		// after a hijack the protocol is switched, like with websocket.
+		rw.hijacked = true
+		if !rw.wroteHeader {
+			rw.wroteHeader = true
+			rw.status = http.StatusSwitchingProtocols
+		}
+	}
+	return conn, brw, err
+}
+
+func (rw *responseWriter) Push(target string, opts *http.PushOptions) error {
+	p, ok := rw.ResponseWriter.(http.Pusher)
+	if !ok {
+		return http.ErrNotSupported
+	}
+	return p.Push(target, opts)
+}
+
+func (rw *responseWriter) ReadFrom(src io.Reader) (int64, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	var (
+		n   int64
+		err error
+	)
+	if rf, ok := rw.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		// writerOnly hides ReadFrom to avoid io.Copy calling back into this method.
+		n, err = io.Copy(writerOnly{rw.ResponseWriter}, src)
+	}
+	rw.written += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying http.ResponseWriter.
+func (rw *responseWriter) Unwrap() http.ResponseWriter { return rw.ResponseWriter }
+
+type writerOnly struct{ io.Writer }
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net"
+	"net/http"
+)
+
+// TrustPolicy tells whether the trace context sent by the caller of a request can be trusted.
+// Untrusted requests start a new trace, linked to the remote span context instead of being its child,
+// and their baggage is dropped, so a foreign client cannot stitch itself into our traces or force sampling.
+type TrustPolicy func(r *http.Request) bool
+
+// WithTrustPolicy sets the policy that decides which callers may parent the server spans.
+// By default, the trace context of every caller is trusted.
+func WithTrustPolicy(policy TrustPolicy) Option {
+	return func(c *config) { c.trustPolicy = policy }
+}
+
+// TrustAny trusts the requests trusted by any of the policies.
+func TrustAny(policies ...TrustPolicy) TrustPolicy {
+	return func(r *http.Request) bool {
+		for _, policy := range policies {
+			if policy(r) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// TrustNetworks trusts the requests whose remote address is within one of the networks, like "10.0.0.0/8".
+func TrustNetworks(cidrs ...string) (TrustPolicy, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return func(r *http.Request) bool {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		ip := net.ParseIP(host)
+		if ip == nil {
+			return false
+		}
+		for _, n := range nets {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// TrustHeader trusts the requests that carry the header, like one set by our own gateway.
+// When value is empty, the presence of the header is enough.
+func TrustHeader(key, value string) TrustPolicy {
+	return func(r *http.Request) bool {
+		values, ok := r.Header[http.CanonicalHeaderKey(key)]
+		if !ok {
+			return false
+		}
+		if value == "" {
+			return true
+		}
+		for _, v := range values {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	}
+}